@@ -0,0 +1,342 @@
+package downloader
+
+import (
+	"cloud_distributed_storage/Backend/util"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrChecksumMismatch : 下载完成后文件的sha1与filehash不一致, 本地的临时文件及状态文件已删除
+var ErrChecksumMismatch = errors.New("downloader: sha1 of downloaded file does not match filehash")
+
+// errURLExpired : 下载地址已失效(如预签名地址过期), 需要重新获取
+var errURLExpired = errors.New("downloader: download url expired")
+
+// Options : 下载参数
+type Options struct {
+	// Workers : 并发下载的分段数
+	Workers int
+	// SegmentSize : 每个分段的大小(字节)
+	SegmentSize int64
+	// MaxRetries : 单个分段失败后的最大重试次数
+	MaxRetries int
+	// RetryDelay : 首次重试前的等待时间, 之后每次翻倍
+	RetryDelay time.Duration
+	// HTTPClient : 为nil时使用http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// DefaultOptions : 默认下载参数
+var DefaultOptions = Options{
+	Workers:     4,
+	SegmentSize: 8 * 1024 * 1024,
+	MaxRetries:  5,
+	RetryDelay:  time.Second,
+}
+
+// Client : 下载服务客户端
+type Client struct {
+	// BaseURL : 下载服务地址, 如http://127.0.0.1:38000
+	BaseURL  string
+	UserName string
+	Token    string
+	Options  Options
+
+	mu  sync.Mutex
+	url string
+}
+
+// New : 创建下载服务客户端, opts中未设置的字段使用DefaultOptions
+func New(baseURL, username, token string, opts Options) *Client {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultOptions.Workers
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultOptions.SegmentSize
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = DefaultOptions.MaxRetries
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultOptions.RetryDelay
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	return &Client{
+		BaseURL:  strings.TrimRight(baseURL, "/"),
+		UserName: username,
+		Token:    token,
+		Options:  opts,
+	}
+}
+
+// DownloadURL : 通过/file/downloadurl获取文件的下载地址
+func (c *Client) DownloadURL(ctx context.Context, filehash string) (string, error) {
+	form := url.Values{"filehash": {filehash}, "username": {c.UserName}, "token": {c.Token}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/file/downloadurl", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.Options.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	// 成功时响应体即为下载地址, 失败时为{"code","msg"}
+	text := strings.TrimSpace(string(body))
+	if resp.StatusCode != http.StatusOK || strings.HasPrefix(text, "{") {
+		var errResp struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		}
+		json.Unmarshal(body, &errResp)
+		return "", fmt.Errorf("downloader: failed to get download url of %s: status %d, code %d, %s",
+			filehash, resp.StatusCode, errResp.Code, errResp.Msg)
+	}
+	return text, nil
+}
+
+// currentURL : 获取下载地址, refresh为true时重新向下载服务申请
+func (c *Client) currentURL(ctx context.Context, filehash string, refresh bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.url != "" && !refresh {
+		return c.url, nil
+	}
+	u, err := c.DownloadURL(ctx, filehash)
+	if err != nil {
+		return "", err
+	}
+	c.url = u
+	return u, nil
+}
+
+// Download : 将filehash对应的文件下载到dest
+// 文件按SegmentSize分段并发下载到dest+".part", 已完成的分段记录在dest+".state"中,
+// 中断后以相同参数再次调用会跳过已完成的分段; 全部完成后校验sha1再重命名为dest
+func (c *Client) Download(ctx context.Context, filehash, dest string) error {
+	c.mu.Lock()
+	c.url = ""
+	c.mu.Unlock()
+
+	size, etag, err := c.probe(ctx, filehash)
+	if err != nil {
+		return err
+	}
+
+	// .part文件已不存在时状态文件记录的分段也已失效
+	if _, err = os.Stat(partFile(dest)); errors.Is(err, os.ErrNotExist) {
+		os.Remove(stateFile(dest))
+	}
+	st, err := loadState(stateFile(dest), filehash, size, c.Options.SegmentSize)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(partFile(dest), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err = f.Truncate(size); err == nil {
+		err = c.fetchSegments(ctx, filehash, etag, f, st)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = verify(partFile(dest), filehash); err != nil {
+		os.Remove(partFile(dest))
+		os.Remove(stateFile(dest))
+		return err
+	}
+	if err = os.Rename(partFile(dest), dest); err != nil {
+		return err
+	}
+	return os.Remove(stateFile(dest))
+}
+
+// probe : 请求第一个字节, 获取文件大小及ETag
+func (c *Client) probe(ctx context.Context, filehash string) (int64, string, error) {
+	var size int64
+	var etag string
+	err := c.withRetry(ctx, filehash, func(u string) error {
+		resp, err := c.get(ctx, u, "bytes=0-0", "")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+
+		switch resp.StatusCode {
+		case http.StatusPartialContent:
+			var start, end int64
+			_, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size)
+			if err != nil {
+				return fmt.Errorf("downloader: invalid Content-Range %q", resp.Header.Get("Content-Range"))
+			}
+		case http.StatusRequestedRangeNotSatisfiable:
+			// 空文件
+			size = 0
+		default:
+			return statusErr(resp)
+		}
+		etag = resp.Header.Get("ETag")
+		return nil
+	})
+	return size, etag, err
+}
+
+// fetchSegments : 并发下载所有未完成的分段
+func (c *Client) fetchSegments(ctx context.Context, filehash, etag string, f *os.File, st *state) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	todo := make(chan int)
+	errCh := make(chan error, c.Options.Workers)
+	var wg sync.WaitGroup
+	for i := 0; i < c.Options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range todo {
+				err := c.withRetry(ctx, filehash, func(u string) error {
+					return c.fetchSegment(ctx, u, etag, f, st.segment(idx))
+				})
+				if err == nil {
+					err = st.markDone(idx)
+				}
+				if err != nil {
+					errCh <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, idx := range st.pending() {
+		select {
+		case todo <- idx:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(todo)
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+// fetchSegment : 下载一个分段并写入文件中对应的位置
+func (c *Client) fetchSegment(ctx context.Context, u, etag string, f *os.File, seg util.HTTPRange) error {
+	rangeHeader := fmt.Sprintf("bytes=%d-%d", seg.Start, seg.Start+seg.Length-1)
+	resp, err := c.get(ctx, u, rangeHeader, etag)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return statusErr(resp)
+	}
+	// 携带If-Range时文件变化会返回200, 不会走到这里; 仍校验区间防止服务端忽略Range
+	var start, end, total int64
+	if _, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil ||
+		start != seg.Start || end != seg.Start+seg.Length-1 {
+		return fmt.Errorf("downloader: unexpected Content-Range %q for %s", resp.Header.Get("Content-Range"), rangeHeader)
+	}
+
+	n, err := io.Copy(io.NewOffsetWriter(f, seg.Start), io.LimitReader(resp.Body, seg.Length))
+	if err == nil && n != seg.Length {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (c *Client) get(ctx context.Context, u, rangeHeader, etag string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", rangeHeader)
+	if strings.HasPrefix(etag, `"`) {
+		req.Header.Set("If-Range", etag)
+	}
+	return c.Options.HTTPClient.Do(req)
+}
+
+// withRetry : 执行fn, 失败后按指数退避重试; 下载地址失效时重新获取地址
+func (c *Client) withRetry(ctx context.Context, filehash string, fn func(u string) error) error {
+	delay := c.Options.RetryDelay
+	refresh := false
+	var err error
+	for attempt := 0; attempt <= c.Options.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			delay *= 2
+		}
+		var u string
+		if u, err = c.currentURL(ctx, filehash, refresh); err == nil {
+			err = fn(u)
+		}
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		refresh = errors.Is(err, errURLExpired)
+	}
+	return err
+}
+
+func statusErr(resp *http.Response) error {
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: status %d", errURLExpired, resp.StatusCode)
+	}
+	return fmt.Errorf("downloader: unexpected status %d", resp.StatusCode)
+}
+
+// verify : 校验文件的sha1
+func verify(path, filehash string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sha1Stream := &util.Sha1Stream{}
+	if _, err = io.Copy(sha1Stream, f); err != nil {
+		return err
+	}
+	if !strings.EqualFold(sha1Stream.Sum(), filehash) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+func partFile(dest string) string  { return dest + ".part" }
+func stateFile(dest string) string { return dest + ".state" }
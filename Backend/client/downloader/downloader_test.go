@@ -0,0 +1,127 @@
+package downloader
+
+import (
+	"bytes"
+	"cloud_distributed_storage/Backend/util"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer : 模拟下载服务, /file/downloadurl返回/file/download的地址
+type fakeServer struct {
+	*httptest.Server
+	data     []byte
+	hash     string
+	failures atomic.Int32 // 前N次分段请求返回500
+	requests atomic.Int32
+}
+
+func newFakeServer(t *testing.T, size int) *fakeServer {
+	data := make([]byte, size)
+	rand.Read(data)
+	s := &fakeServer{data: data, hash: util.Sha1(data)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file/downloadurl", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("filehash") != s.hash {
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": 10002, "msg": "server error"})
+			return
+		}
+		w.Write([]byte(s.URL + "/file/download?filehash=" + s.hash))
+	})
+	mux.HandleFunc("/file/download", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "bytes=0-0" {
+			s.requests.Add(1)
+			if s.failures.Add(-1) >= 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("ETag", `"`+s.hash+`"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(s.data))
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func testOptions() Options {
+	return Options{Workers: 3, SegmentSize: 1000, MaxRetries: 2, RetryDelay: time.Millisecond}
+}
+
+func TestDownload(t *testing.T) {
+	s := newFakeServer(t, 10500)
+	s.failures.Store(2)
+	dest := filepath.Join(t.TempDir(), "out.bin")
+
+	c := New(s.URL, "alice", "token", testOptions())
+	require.NoError(t, c.Download(context.Background(), s.hash, dest))
+
+	got, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, s.data, got)
+	assert.EqualValues(t, 11+2, s.requests.Load())
+	assert.NoFileExists(t, stateFile(dest))
+	assert.NoFileExists(t, partFile(dest))
+}
+
+func TestDownloadResume(t *testing.T) {
+	s := newFakeServer(t, 4500)
+	dest := filepath.Join(t.TempDir(), "out.bin")
+
+	// 模拟中断: 前3个分段已写入.part并记录在状态文件中
+	st, err := loadState(stateFile(dest), s.hash, 4500, 1000)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(partFile(dest), s.data[:3000], 0644))
+	for idx := 0; idx < 3; idx++ {
+		require.NoError(t, st.markDone(idx))
+	}
+
+	c := New(s.URL, "alice", "token", testOptions())
+	require.NoError(t, c.Download(context.Background(), s.hash, dest))
+	got, _ := os.ReadFile(dest)
+	assert.Equal(t, s.data, got)
+	assert.EqualValues(t, 2, s.requests.Load())
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	s := newFakeServer(t, 2500)
+	dest := filepath.Join(t.TempDir(), "out.bin")
+
+	// 状态文件声称已完成的分段实际内容错误
+	st, err := loadState(stateFile(dest), s.hash, 2500, 1000)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(partFile(dest), make([]byte, 2500), 0644))
+	require.NoError(t, st.markDone(0))
+
+	c := New(s.URL, "alice", "token", testOptions())
+	assert.ErrorIs(t, c.Download(context.Background(), s.hash, dest), ErrChecksumMismatch)
+	assert.NoFileExists(t, dest)
+	assert.NoFileExists(t, stateFile(dest))
+
+	// 重新下载时从头开始
+	require.NoError(t, c.Download(context.Background(), s.hash, dest))
+}
+
+func TestDownloadErrors(t *testing.T) {
+	s := newFakeServer(t, 100)
+	c := New(s.URL, "alice", "token", testOptions())
+
+	_, err := c.DownloadURL(context.Background(), "unknown")
+	assert.ErrorContains(t, err, "code 10002")
+
+	s.failures.Store(100)
+	err = c.Download(context.Background(), s.hash, filepath.Join(t.TempDir(), "out.bin"))
+	assert.ErrorContains(t, err, "unexpected status 500")
+}
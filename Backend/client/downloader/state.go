@@ -0,0 +1,79 @@
+package downloader
+
+import (
+	"cloud_distributed_storage/Backend/util"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+// state : 断点续传状态, 记录每个分段是否已写入.part文件
+type state struct {
+	FileHash    string `json:"filehash"`
+	Size        int64  `json:"size"`
+	SegmentSize int64  `json:"segment_size"`
+	Done        []bool `json:"done"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// loadState : 读取状态文件, 文件不存在或与本次下载不匹配时从头开始
+func loadState(path, filehash string, size, segmentSize int64) (*state, error) {
+	count := (size + segmentSize - 1) / segmentSize
+	fresh := &state{FileHash: filehash, Size: size, SegmentSize: segmentSize, Done: make([]bool, count), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	st := &state{}
+	if json.Unmarshal(data, st) != nil || st.FileHash != filehash || st.Size != size ||
+		st.SegmentSize != segmentSize || int64(len(st.Done)) != count {
+		return fresh, nil
+	}
+	st.path = path
+	return st, nil
+}
+
+// segment : 第idx个分段对应的字节区间
+func (s *state) segment(idx int) util.HTTPRange {
+	start := int64(idx) * s.SegmentSize
+	length := s.SegmentSize
+	if start+length > s.Size {
+		length = s.Size - start
+	}
+	return util.HTTPRange{Start: start, Length: length}
+}
+
+// pending : 尚未完成的分段序号
+func (s *state) pending() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var idxs []int
+	for idx, done := range s.Done {
+		if !done {
+			idxs = append(idxs, idx)
+		}
+	}
+	return idxs
+}
+
+// markDone : 标记分段完成并持久化, 先写临时文件再重命名, 避免中断时留下损坏的状态文件
+func (s *state) markDone(idx int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Done[idx] = true
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(s.path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
@@ -0,0 +1,25 @@
+package common
+
+// FileStatus : tbl_file中文件的状态
+type FileStatus int
+
+const (
+	// FileAvailable : 正常可用
+	FileAvailable FileStatus = 1
+	// FileDisabled : 已禁用
+	FileDisabled FileStatus = 2
+	// FileCorrupt : 巡检发现对象内容与file_sha1不符, 且无法从副本修复
+	FileCorrupt FileStatus = 3
+	// FileMissing : 巡检发现对象已不存在, 且无法从副本修复
+	FileMissing FileStatus = 4
+)
+
+// UserFileStatus : tbl_user_file中用户文件的状态
+type UserFileStatus int
+
+const (
+	// UserFileNormal : 正常
+	UserFileNormal UserFileStatus = 0
+	// UserFileDeleted : 已删除, 在回收站中可恢复, 超过PurgeDeletedAfter后被彻底清除
+	UserFileDeleted UserFileStatus = 2
+)
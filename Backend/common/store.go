@@ -15,4 +15,6 @@ const (
 	StoreMix
 	// StoreAll : 所有类型的存储都存一份数据
 	StoreAll
+	// StoreMinio : MinIO对象存储
+	StoreMinio
 )
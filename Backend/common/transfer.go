@@ -0,0 +1,15 @@
+package common
+
+// TransferStatus : 文件转移任务的状态
+type TransferStatus int
+
+const (
+	// TransferQueued : 已投递到转移队列, 等待处理
+	TransferQueued TransferStatus = iota
+	// TransferRunning : 转移中
+	TransferRunning
+	// TransferSucceeded : 转移成功
+	TransferSucceeded
+	// TransferFailed : 转移失败, 重试次数已耗尽或遇到无法重试的错误
+	TransferFailed
+)
@@ -0,0 +1,23 @@
+package config
+
+import (
+	cmn "cloud_distributed_storage/Backend/common"
+	"time"
+)
+
+const (
+	// LifecycleEnable : 是否由transfer服务定期执行生命周期规则
+	LifecycleEnable = true
+	// LifecycleInterval : 执行生命周期规则的周期
+	LifecycleInterval = 6 * time.Hour
+	// LifecycleBatchSize : 每条规则每次最多处理的文件数
+	LifecycleBatchSize = 200
+	// ColdTierAfter : 所有用户超过该时长未下载/修改的文件视为冷数据
+	ColdTierAfter = 90 * 24 * time.Hour
+	// ColdTierFrom : 冷数据所在的存储类型
+	ColdTierFrom = cmn.StoreMinio
+	// ColdTierTo : 冷数据迁移到的存储类型
+	ColdTierTo = cmn.StoreS3
+	// PurgeDeletedAfter : 用户删除的文件保留该时长后彻底清除, 不再被任何用户引用的文件同时删除存储中的对象
+	PurgeDeletedAfter = 30 * 24 * time.Hour
+)
@@ -1,7 +1,6 @@
 package config
 
 import (
-	"fmt"
 	"log"
 	"os"
 
@@ -12,8 +11,8 @@ import (
 func init() {
 	err := godotenv.Load("/usr/local/Distributed_system/cloud_distributed_storage/Backend/.env")
 	if err != nil {
-		log.Fatal("Error loading .env file")
-		fmt.Println(err.Error())
+		// 缺少.env时使用进程环境变量, 便于在测试等环境中加载配置
+		log.Println("Error loading .env file: " + err.Error())
 	}
 }
 
@@ -25,4 +24,6 @@ var (
 	// MinioEndpoint : gateway地址
 	MinioEndpoint = "172.22.0.20:9000"
 	MinioUseSSL   = false
+	// MinioBucket : 文件存储使用的bucket
+	MinioBucket = "filestore"
 )
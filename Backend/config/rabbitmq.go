@@ -1,8 +1,12 @@
 package config
 
+import "time"
+
 const (
 	//AsyncTransferEnable : 是否开启文件异步转移(默认同步)
 	AsyncTransferEnable = true
+	//MQDriver : 消息中间件驱动, amqp(RabbitMQ)或memory(进程内, 用于测试及单机部署)
+	MQDriver = "amqp"
 	//TransExchangeName : 用于文件transfer的交换机
 	TransExchangeName = "uploadserver.trans"
 	//TransS3QueueName : s3转移队列名
@@ -11,6 +15,24 @@ const (
 	TransS3ErrQueueName = "uploadserver.trans.s3.err"
 	//TransS3RoutingKey: s3转移队列路由名
 	TransS3RoutingKey = "s3"
+	//TransMaxRetries : 转移失败后的最大重试次数, 超过后写入错误队列
+	TransMaxRetries = 5
+	//TransRetryBaseDelay : 重试的初始等待时间, 每次重试翻倍
+	TransRetryBaseDelay = time.Second
+	//TransRetryMaxDelay : 重试等待时间的上限
+	TransRetryMaxDelay = time.Minute
+	//TransferWorkers : 转移服务并发处理的worker数, 也是每个消费者预取的消息数
+	TransferWorkers = 4
+	//TransferShutdownTimeout : 转移服务退出时等待处理中任务完成的最长时间
+	TransferShutdownTimeout = 30 * time.Second
+	//MQConfirmTimeout : 等待broker发布确认的超时时间
+	MQConfirmTimeout = 5 * time.Second
+	//MQReconnectDelay : 断线重连的间隔
+	MQReconnectDelay = 3 * time.Second
+	//MQOutboxSize : 最多缓存的未确认消息数, 由后台定期及重连后重新发布
+	MQOutboxSize = 10000
+	//MQOutboxRetryInterval : 重新发布outbox中未确认消息的周期
+	MQOutboxRetryInterval = 10 * time.Second
 )
 
 var (
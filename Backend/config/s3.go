@@ -1,7 +1,6 @@
 package config
 
 import (
-	"fmt"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
@@ -11,8 +10,8 @@ func init() {
 	// Load .env file
 	err := godotenv.Load("/usr/local/Distributed_system/cloud_distributed_storage/Backend/.env")
 	if err != nil {
-		fmt.Println(err.Error())
-		log.Fatal("Error loading .env file")
+		// 缺少.env时使用进程环境变量, 便于在测试等环境中加载配置
+		log.Println("Error loading .env file: " + err.Error())
 	}
 }
 
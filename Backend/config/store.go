@@ -2,6 +2,7 @@ package config
 
 import (
 	cmn "cloud_distributed_storage/Backend/common"
+	"time"
 )
 
 const (
@@ -13,6 +14,44 @@ const (
 	MinioRootDir = "/minio"
 	// S3RootDir : S3的存储路径prefix
 	S3RootDir = "S3/"
+	// StoragePolicyFile : 存储放置策略文件(json), 为空时使用内置策略(文件名以VI结尾存MinIO, 其余存S3)
+	StoragePolicyFile = ""
 	// CurrentStoreType : 设置当前文件的存储类型
 	CurrentStoreType = cmn.StoreLocal
+	// ChunkDedupEnable : 是否开启分块去重存储(文件按内容切分, 相同的分块只存一份)
+	ChunkDedupEnable = false
+	// ChunkStoreType : 分块去重模式下分块写入的存储类型
+	ChunkStoreType = cmn.StoreMinio
+	// ChunkManifestRootDir : 分块去重文件的file_addr前缀, 文件内容由分块清单描述
+	ChunkManifestRootDir = "/cdc/"
+	// MultipartDirectEnable : 分块上传是否直接使用S3/MinIO的原生分块上传(不经过本地合并)
+	MultipartDirectEnable = false
+	// UploadStagingDir : 直传对象在校验通过前的暂存前缀, 校验通过后才复制到以filehash命名的最终位置
+	UploadStagingDir = "uploads/"
+	// PresignExpiry : 预签名上传/下载地址的有效期
+	PresignExpiry = 15 * time.Minute
+	// MultipartMinChunkSize : 分块上传允许的最小分块, 也是S3分块上传要求的最小分块(最后一块除外)
+	MultipartMinChunkSize int64 = 5 * 1024 * 1024
+	// MultipartMaxChunkSize : 分块上传允许的最大分块, 分块直传时分块会整块读入内存
+	MultipartMaxChunkSize int64 = 128 * 1024 * 1024
+	// MultipartMaxParts : 单个文件最多的分块数, 与S3的上限一致
+	MultipartMaxParts = 10000
+	// UploadSessionTTL : 分块/预签名上传会话的有效期, 每次上传分块后顺延
+	UploadSessionTTL = 24 * time.Hour
+	// UploadSessionReapInterval : 清理过期上传会话的周期
+	UploadSessionReapInterval = 10 * time.Minute
+	// TempSweepInterval : 清理本地临时目录的周期
+	TempSweepInterval = time.Hour
+	// TempSweepMinAge : 只清理超过该时长未修改的本地临时文件, 避免误删上传中的文件
+	TempSweepMinAge = 24 * time.Hour
+	// ScrubEnable : 是否由transfer服务定期巡检存储中的对象是否与file_sha1一致
+	ScrubEnable = true
+	// ScrubInterval : 完整巡检一轮tbl_file的周期
+	ScrubInterval = 24 * time.Hour
+	// ScrubBatchSize : 巡检时每批从tbl_file读取的记录数
+	ScrubBatchSize = 100
+	// ScrubRepairEnable : 发现损坏或丢失的对象时是否尝试用完好的副本修复
+	ScrubRepairEnable = true
+	// UploadMaxSize : 普通上传接口允许的最大文件大小(字节), 更大的文件请使用分块上传
+	UploadMaxSize int64 = 4 * 1024 * 1024 * 1024
 )
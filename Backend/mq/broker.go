@@ -0,0 +1,89 @@
+package mq
+
+import (
+	"cloud_distributed_storage/Backend/config"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Publisher : 消息发布者
+type Publisher interface {
+	// Publish : 发布消息, broker接收后才返回nil
+	Publish(exchange, routingKey string, msg []byte) error
+}
+
+// Handler : 消息处理函数, retries为该消息已重试的次数, 可据此判断失败后是否还会重试(见LastAttempt)
+type Handler func(msg []byte, retries int) error
+
+// Consumer : 消息消费者
+type Consumer interface {
+	// Consume : 启动workers个worker并发消费队列qName, 阻塞直到Stop被调用
+	// handler返回nil时确认消息; 失败时按退避策略重试, 永久失败或重试次数耗尽后转入错误队列errQName
+	Consume(qName, errQName, cName string, workers int, handler Handler)
+	// Stop : 停止接收新消息并等待处理中的消息完成, 超过timeout仍未完成的消息退回队列重新投递
+	Stop(timeout time.Duration)
+	// ReplayErrQueue : 将错误队列中的消息重新投递到qName, limit<=0时重放全部
+	ReplayErrQueue(errQName, qName string, limit int) (int, error)
+}
+
+// Broker : 消息中间件驱动
+type Broker interface {
+	Publisher
+	Consumer
+}
+
+var (
+	brokerMu      sync.Mutex
+	defaultBroker Broker
+	drivers       = map[string]func() Broker{
+		"amqp":   func() Broker { return &amqpBroker{} },
+		"memory": func() Broker { return NewMemoryBroker() },
+	}
+)
+
+// Default : 获取config.MQDriver指定的broker
+func Default() Broker {
+	brokerMu.Lock()
+	defer brokerMu.Unlock()
+	if defaultBroker == nil {
+		newBroker, ok := drivers[config.MQDriver]
+		if !ok {
+			panic(fmt.Sprintf("mq: unknown driver %q", config.MQDriver))
+		}
+		defaultBroker = newBroker()
+	}
+	return defaultBroker
+}
+
+// SetDefault : 替换默认的broker, 测试中可换成内存实现
+func SetDefault(b Broker) {
+	brokerMu.Lock()
+	defer brokerMu.Unlock()
+	defaultBroker = b
+}
+
+// Publish : 发布消息到默认broker
+func Publish(exchange, routingKey string, msg []byte) bool {
+	if err := Default().Publish(exchange, routingKey, msg); err != nil {
+		log.Println(err.Error())
+		return false
+	}
+	return true
+}
+
+// StartConsume : 使用默认broker并发消费队列, 阻塞直到StopConsume
+func StartConsume(qName, errQName, cName string, workers int, callback Handler) {
+	Default().Consume(qName, errQName, cName, workers, callback)
+}
+
+// StopConsume : 停止消费, 最多等待timeout让处理中的消息完成
+func StopConsume(timeout time.Duration) {
+	Default().Stop(timeout)
+}
+
+// ReplayErrQueue : 将错误队列中的消息重新投递到原队列, 重试次数清零
+func ReplayErrQueue(errQName, qName string, limit int) (int, error) {
+	return Default().ReplayErrQueue(errQName, qName, limit)
+}
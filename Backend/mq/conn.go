@@ -2,15 +2,57 @@ package mq
 
 import (
 	"cloud_distributed_storage/Backend/config"
-	"github.com/streadway/amqp"
+	"errors"
 	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+var (
+	// mu : 保护连接状态及deliveryTag的分配, 只在发布时短暂持有, 不在等待确认时持有
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+
+	// 如果异常关闭，会接收通知
+	notifyClose chan *amqp.Error
+	// deliveryTag : 当前channel上最后一条消息的deliveryTag, 每条消息递增
+	deliveryTag uint64
+	// tracker : 当前channel上等待确认的消息
+	tracker *confirmTracker
+
+	// outbox : 未被broker确认的消息, 由outbox重发循环及重连时按原顺序重新发布
+	outboxMu  sync.Mutex
+	outbox    = map[uint64]outboxMsg{}
+	outboxSeq uint64
+	// flushMu : 保证同一时刻只有一次outbox重发
+	flushMu sync.Mutex
 )
 
-var conn *amqp.Connection
-var channel *amqp.Channel
+// confirmBuffer : 发布确认通道的容量, 由confirmTracker.run及时取走, 不会阻塞amqp连接的读协程
+const confirmBuffer = 1024
 
-// 如果异常关闭，会接收通知
-var notifyClose chan *amqp.Error
+var errNotConnected = errors.New("mq: not connected")
+
+// amqpBroker : 基于RabbitMQ的broker, 连接状态保存在包级变量中, 整个进程共用一个连接
+type amqpBroker struct {
+	mu      sync.Mutex
+	cName   string
+	stop    chan struct{}
+	stopped chan struct{}
+	slots   []*inflight
+}
+
+// outboxMsg : 待确认的消息
+type outboxMsg struct {
+	exchange   string
+	routingKey string
+	body       []byte
+	headers    map[string]interface{}
+}
 
 // UpdateRabbitHost : 更新mq host
 func UpdateRabbitHost(host string) {
@@ -23,38 +65,249 @@ func Init() {
 	if !config.AsyncTransferEnable {
 		return
 	}
-	if initChannel(config.RabbitURL) {
-		channel.NotifyClose(notifyClose)
+	if _, ok := Default().(*amqpBroker); !ok {
+		return
 	}
+	initChannel(config.RabbitURL)
+
+	// 定期重发未确认的消息, 连接正常时被nack或确认超时的消息也能重新发布
+	go func() {
+		ticker := time.NewTicker(config.MQOutboxRetryInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if currentChannel() != nil {
+				flushOutbox()
+			}
+		}
+	}()
+
 	// 断线自动重连
 	go func() {
 		for {
-			select {
-			case msg := <-notifyClose:
+			mu.Lock()
+			closed := notifyClose
+			mu.Unlock()
+
+			if closed != nil {
+				msg := <-closed
+				log.Printf("onNotifyChannelClosed: %+v\n", msg)
+				mu.Lock()
 				conn = nil
 				channel = nil
-				log.Printf("onNotifyChannelClosed: %+v\n", msg)
-				initChannel(config.RabbitURL)
+				notifyClose = nil
+				mu.Unlock()
+			}
+			for !initChannel(config.RabbitURL) {
+				time.Sleep(config.MQReconnectDelay)
 			}
 		}
 	}()
 }
 
 func initChannel(rabbitHost string) bool {
+	mu.Lock()
+	defer mu.Unlock()
 	if channel != nil {
 		return true
 	}
 
-	conn, err := amqp.Dial(rabbitHost)
+	c, err := amqp.Dial(rabbitHost)
 	if err != nil {
 		log.Println(err.Error())
 		return false
 	}
-
-	channel, err = conn.Channel()
+	ch, err := c.Channel()
+	if err == nil {
+		err = declareTopology(ch)
+	}
+	if err == nil {
+		err = ch.Confirm(false)
+	}
 	if err != nil {
 		log.Println(err.Error())
+		c.Close()
 		return false
 	}
+
+	conn = c
+	channel = ch
+	deliveryTag = 0
+	tracker = &confirmTracker{pending: map[uint64]chan bool{}}
+	go tracker.run(ch.NotifyPublish(make(chan amqp.Confirmation, confirmBuffer)))
+	notifyClose = ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	// 重连后重新发布未确认的消息, 发布需要mu, 因此在后台进行
+	go flushOutbox()
 	return true
 }
+
+// declareTopology : 声明持久化的交换机、队列及绑定关系, 保证新部署的broker不会丢弃消息
+func declareTopology(ch *amqp.Channel) error {
+	err := ch.ExchangeDeclare(config.TransExchangeName, amqp.ExchangeDirect, true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	for _, q := range []string{config.TransS3QueueName, config.TransS3ErrQueueName} {
+		if _, err = ch.QueueDeclare(q, true, false, false, false, nil); err != nil {
+			return err
+		}
+	}
+	return ch.QueueBind(config.TransS3QueueName, config.TransS3RoutingKey, config.TransExchangeName, false, nil)
+}
+
+// currentChannel : 当前可用的channel, 未连接时返回nil
+func currentChannel() *amqp.Channel {
+	mu.Lock()
+	defer mu.Unlock()
+	return channel
+}
+
+// confirmTracker : 按deliveryTag将broker的确认分发给等待中的发布者, 每个channel一个
+type confirmTracker struct {
+	// pending : 等待确认的消息, 由mu保护
+	pending map[uint64]chan bool
+	closed  bool
+}
+
+// run : 分发确认直到channel关闭, 关闭后通知所有仍在等待的发布者
+// 已超时放弃等待的消息的确认直接丢弃
+func (t *confirmTracker) run(confirms <-chan amqp.Confirmation) {
+	for c := range confirms {
+		mu.Lock()
+		done, ok := t.pending[c.DeliveryTag]
+		delete(t.pending, c.DeliveryTag)
+		mu.Unlock()
+		if ok {
+			done <- c.Ack
+		}
+	}
+
+	mu.Lock()
+	t.closed = true
+	for tag, done := range t.pending {
+		close(done)
+		delete(t.pending, tag)
+	}
+	mu.Unlock()
+}
+
+// pendingConfirm : 已发布、等待broker确认的消息
+type pendingConfirm struct {
+	tracker *confirmTracker
+	tag     uint64
+	done    chan bool
+}
+
+// send : 发布消息并登记等待确认, 不等待确认
+// 只在写入channel及分配deliveryTag时持有mu, 多条消息的确认可以同时等待
+func send(m outboxMsg) (*pendingConfirm, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if channel == nil || tracker == nil || tracker.closed {
+		return nil, errNotConnected
+	}
+	err := channel.Publish(
+		m.exchange,
+		m.routingKey,
+		false, // 拓扑已声明, 不可路由的消息不会出现
+		false, //
+		amqp.Publishing{
+			ContentType:  "text/plain",
+			DeliveryMode: amqp.Persistent,
+			Headers:      amqp.Table(m.headers),
+			Body:         m.body})
+	if err != nil {
+		return nil, err
+	}
+	deliveryTag++
+	p := &pendingConfirm{tracker: tracker, tag: deliveryTag, done: make(chan bool, 1)}
+	tracker.pending[p.tag] = p.done
+	return p, nil
+}
+
+// wait : 等待broker确认, 超时后放弃等待, 迟到的确认由confirmTracker丢弃
+func (p *pendingConfirm) wait() error {
+	timer := time.NewTimer(config.MQConfirmTimeout)
+	defer timer.Stop()
+	select {
+	case ack, ok := <-p.done:
+		if !ok {
+			return errNotConnected
+		}
+		if !ack {
+			return errors.New("mq: message nacked by broker")
+		}
+		return nil
+	case <-timer.C:
+		mu.Lock()
+		delete(p.tracker.pending, p.tag)
+		mu.Unlock()
+		return errors.New("mq: publish confirm timeout")
+	}
+}
+
+// publish : 发布消息并等待broker确认
+func publish(m outboxMsg) error {
+	p, err := send(m)
+	if err != nil {
+		return err
+	}
+	return p.wait()
+}
+
+// saveOutbox : 将未确认的消息放入outbox等待重发, outbox已满时丢弃
+func saveOutbox(m outboxMsg) {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	if len(outbox) >= config.MQOutboxSize {
+		log.Printf("mq outbox is full, dropping message to %s/%s\n", m.exchange, m.routingKey)
+		return
+	}
+	outboxSeq++
+	outbox[outboxSeq] = m
+}
+
+// flushOutbox : 按原顺序重新发布outbox中的消息, 先全部发布再统一等待确认
+// 确认成功的消息移出outbox, 其余的留待下一次重发
+func flushOutbox() {
+	flushMu.Lock()
+	defer flushMu.Unlock()
+
+	outboxMu.Lock()
+	ids := make([]uint64, 0, len(outbox))
+	for id := range outbox {
+		ids = append(ids, id)
+	}
+	msgs := make([]outboxMsg, 0, len(ids))
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		msgs = append(msgs, outbox[id])
+	}
+	outboxMu.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+
+	pending := make([]*pendingConfirm, 0, len(ids))
+	for _, m := range msgs {
+		p, err := send(m)
+		if err != nil {
+			log.Printf("failed to republish outbox message: %v\n", err)
+			break
+		}
+		pending = append(pending, p)
+	}
+
+	republished := 0
+	for i, p := range pending {
+		if err := p.wait(); err != nil {
+			log.Printf("failed to republish outbox message: %v\n", err)
+			continue
+		}
+		outboxMu.Lock()
+		delete(outbox, ids[i])
+		outboxMu.Unlock()
+		republished++
+	}
+	log.Printf("republished %d/%d unconfirmed messages\n", republished, len(ids))
+}
@@ -1,47 +1,209 @@
 package mq
 
-import "log"
-
-var done chan bool
-
-// StartConsume: Start a consumer and monitor the message queue
-func StartConsume(qName, cName string, callback func(msg []byte) bool) {
-
-	// Start consumer
-	msgs, err := channel.Consume(
-		qName,
-		cName,
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
+import (
+	"cloud_distributed_storage/Backend/config"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// inflight : 记录worker正在处理的消息, 停止超时时据此退回消息
+type inflight struct {
+	mu    sync.Mutex
+	msg   *amqp.Delivery
+	since time.Time
+}
+
+func (s *inflight) set(msg *amqp.Delivery) {
+	s.mu.Lock()
+	s.msg, s.since = msg, time.Now()
+	s.mu.Unlock()
+}
+
+// take : 取走正在处理的消息, 已被取走时返回nil
+func (s *inflight) take() *amqp.Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg := s.msg
+	s.msg = nil
+	return msg
+}
+
+// Consume : 启动workers个worker并发消费队列, 阻塞直到Stop
+// 通过QoS限制未确认的消息数等于worker数; 连接断开后会在重连成功时重新订阅
+func (b *amqpBroker) Consume(qName, errQName, cName string, workers int, callback Handler) {
+	if workers <= 0 {
+		workers = 1
+	}
+	b.mu.Lock()
+	b.cName = cName
+	b.stop = make(chan struct{})
+	b.stopped = make(chan struct{})
+	b.slots = make([]*inflight, workers)
+	for i := range b.slots {
+		b.slots[i] = &inflight{}
+	}
+	b.mu.Unlock()
+	defer close(b.stopped)
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		default:
+		}
+
+		ch := currentChannel()
+		if ch == nil {
+			time.Sleep(config.MQReconnectDelay)
+			continue
+		}
+		// 每个worker最多预取一条消息
+		err := ch.Qos(workers, 0, false)
+		if err == nil {
+			err = declareRetryQueues(ch, qName)
+		}
+		var msgs <-chan amqp.Delivery
+		if err == nil {
+			msgs, err = ch.Consume(
+				qName,
+				cName,
+				false, // 手动确认
+				false,
+				false,
+				false,
+				nil,
+			)
+		}
+		if err != nil {
+			log.Println(err.Error())
+			time.Sleep(config.MQReconnectDelay)
+			continue
+		}
+
+		var wg sync.WaitGroup
+		for _, slot := range b.slots {
+			wg.Add(1)
+			go func(slot *inflight) {
+				defer wg.Done()
+				for msg := range msgs {
+					b.process(slot, msg, qName, errQName, callback)
+				}
+			}(slot)
+		}
+		wg.Wait()
+		log.Printf("consumer %s disconnected\n", cName)
+	}
+}
+
+// declareRetryQueues : 声明qName的延迟重试队列, 消息过期后经默认交换机转回qName
+func declareRetryQueues(ch *amqp.Channel, qName string) error {
+	for _, delay := range retryDelays() {
+		_, err := ch.QueueDeclare(retryQueueName(qName, delay), true, false, false, false, amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": qName,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// process : 处理一条消息
+// 成功后确认; 失败时投递到延迟重试队列或错误队列后再确认原消息, 投递失败时退回原消息, 保证消息不丢失
+// 重试的等待由延迟队列完成, worker不会因等待而占住预取的消息
+func (b *amqpBroker) process(slot *inflight, msg amqp.Delivery, qName, errQName string, callback Handler) {
+	select {
+	case <-b.stop:
+		// 停止后不再处理新消息, 退回队列由其他消费者处理
+		msg.Nack(false, true)
+		return
+	default:
+	}
+
+	slot.set(&msg)
+	cause := callback(msg.Body, retryCount(msg.Headers))
+	if cause == nil {
+		if slot.take() != nil {
+			msg.Ack(false)
+		}
+		return
+	}
+
+	target, headers, delay := routeFailure(msg.Headers, qName, errQName, cause)
+	if delay > 0 {
+		target = retryQueueName(target, delay)
+	}
+	if slot.take() == nil {
+		// 停止超时时已被退回
+		return
+	}
+	if err := publishRaw("", target, msg.Body, headers); err != nil {
 		log.Println(err.Error())
+		msg.Nack(false, true)
 		return
 	}
+	msg.Ack(false)
+}
 
-	done = make(chan bool)
+// Stop : 停止接收新消息, 等待处理中的消息完成; 超过timeout仍未完成的消息退回队列重新投递
+func (b *amqpBroker) Stop(timeout time.Duration) {
+	b.mu.Lock()
+	stop, stopped := b.stop, b.stopped
+	b.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
 
-	go func() {
-		for msg := range msgs {
-			// Process the message
-			processSuc := callback(msg.Body)
-			if !processSuc {
+	ch := currentChannel()
+	if ch != nil {
+		ch.Cancel(b.cName, false)
+	}
 
+	select {
+	case <-stopped:
+		log.Println("all in-flight messages finished")
+	case <-time.After(timeout):
+		for i, slot := range b.slots {
+			if msg := slot.take(); msg != nil {
+				log.Printf("worker %d still busy after %s, message requeued\n", i, time.Since(slot.since))
+				msg.Nack(false, true)
 			}
 		}
-	}()
-
-	// Waiting for exit signal
-	<-done
+	}
 
 	// Close the channel
-	channel.Close()
+	if ch != nil {
+		ch.Close()
+	}
 }
 
-// StopConsume: Stop consuming messages
-func StopConsume() {
-	done <- true
+// ReplayErrQueue : 将错误队列中的消息重新投递到原队列, 重试次数清零
+func (b *amqpBroker) ReplayErrQueue(errQName, qName string, limit int) (int, error) {
+	if !initChannel(config.RabbitURL) {
+		return 0, errNotConnected
+	}
+
+	count := 0
+	for limit <= 0 || count < limit {
+		msg, ok, err := currentChannel().Get(errQName, false)
+		if err != nil {
+			return count, err
+		}
+		if !ok {
+			break
+		}
+		if err = publishRaw("", qName, msg.Body, replayHeaders(msg.Headers)); err != nil {
+			msg.Nack(false, true)
+			return count, err
+		}
+		msg.Ack(false)
+		count++
+	}
+	return count, nil
 }
@@ -1,6 +1,9 @@
 package mq
 
-import "cloud_distributed_storage/Backend/common"
+import (
+	"cloud_distributed_storage/Backend/common"
+	"errors"
+)
 
 // TransferData : 定义一个数据传输的结构体
 type TransferData struct {
@@ -8,4 +11,41 @@ type TransferData struct {
 	CurLocation   string
 	DestLocation  string
 	DestStoreType common.StoreType
+	// JobID : tbl_transfer_job中的任务id, 为0时不记录任务状态
+	JobID    int64
+	UserName string
+	// Replica : 为true时目标位置作为副本记录到tbl_file_replica, 不修改file_addr, 也不删除源文件
+	Replica bool
+	// Move : 为true时转移成功后删除源对象(本地临时文件总是删除), 用于冷数据迁移
+	Move bool
+}
+
+// 消息头, 记录重试次数及失败原因
+const (
+	HeaderRetryCount    = "x-retry-count"
+	HeaderError         = "x-error"
+	HeaderFailedAt      = "x-failed-at"
+	HeaderOriginalQueue = "x-original-queue"
+)
+
+// permanentError : 重试也无法成功的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent : 将错误标记为永久失败, 消费者不再重试, 直接转入错误队列
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent : 判断是否为永久失败
+func IsPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
 }
@@ -0,0 +1,179 @@
+package mq
+
+import (
+	"cloud_distributed_storage/Backend/config"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// memoryQueueSize : 内存队列的容量
+const memoryQueueSize = 1024
+
+// memoryMsg : 内存队列中的消息
+type memoryMsg struct {
+	body    []byte
+	headers map[string]interface{}
+}
+
+// MemoryBroker : 进程内的broker, 与amqp实现有相同的路由及重试语义, 进程退出后消息丢失
+type MemoryBroker struct {
+	mu       sync.Mutex
+	queues   map[string]chan memoryMsg
+	bindings map[string]string
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	inflight atomic.Int32
+}
+
+// NewMemoryBroker : 创建进程内broker, 拓扑与RabbitMQ中声明的一致
+func NewMemoryBroker() *MemoryBroker {
+	b := &MemoryBroker{
+		queues:   map[string]chan memoryMsg{},
+		bindings: map[string]string{},
+		stop:     make(chan struct{}),
+	}
+	b.Bind(config.TransExchangeName, config.TransS3RoutingKey, config.TransS3QueueName)
+	b.queue(config.TransS3ErrQueueName)
+	return b
+}
+
+// Bind : 将交换机exchange上路由键为routingKey的消息投递到队列qName
+func (b *MemoryBroker) Bind(exchange, routingKey, qName string) {
+	b.mu.Lock()
+	b.bindings[exchange+"/"+routingKey] = qName
+	b.mu.Unlock()
+	b.queue(qName)
+}
+
+func (b *MemoryBroker) queue(name string) chan memoryMsg {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q, ok := b.queues[name]
+	if !ok {
+		q = make(chan memoryMsg, memoryQueueSize)
+		b.queues[name] = q
+	}
+	return q
+}
+
+// route : exchange为空时直接投递到名为routingKey的队列
+func (b *MemoryBroker) route(exchange, routingKey string) (chan memoryMsg, error) {
+	if exchange == "" {
+		return b.queue(routingKey), nil
+	}
+	b.mu.Lock()
+	qName, ok := b.bindings[exchange+"/"+routingKey]
+	b.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("mq: no queue bound to %s/%s", exchange, routingKey)
+	}
+	return b.queue(qName), nil
+}
+
+func (b *MemoryBroker) push(q chan memoryMsg, m memoryMsg) error {
+	select {
+	case q <- m:
+		return nil
+	default:
+		return fmt.Errorf("mq: memory queue is full")
+	}
+}
+
+func (b *MemoryBroker) Publish(exchange, routingKey string, msg []byte) error {
+	q, err := b.route(exchange, routingKey)
+	if err != nil {
+		return err
+	}
+	return b.push(q, memoryMsg{body: msg})
+}
+
+func (b *MemoryBroker) Consume(qName, errQName, cName string, workers int, handler Handler) {
+	if workers <= 0 {
+		workers = 1
+	}
+	q := b.queue(qName)
+	for i := 0; i < workers; i++ {
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			for {
+				select {
+				case <-b.stop:
+					return
+				case m := <-q:
+					b.process(q, m, qName, errQName, handler)
+				}
+			}
+		}()
+	}
+	b.wg.Wait()
+}
+
+func (b *MemoryBroker) process(q chan memoryMsg, m memoryMsg, qName, errQName string, handler Handler) {
+	b.inflight.Add(1)
+	defer b.inflight.Add(-1)
+
+	err := handler(m.body, retryCount(m.headers))
+	if err == nil {
+		return
+	}
+	target, headers, delay := routeFailure(m.headers, qName, errQName, err)
+	redeliver := func() {
+		if err := b.push(b.queue(target), memoryMsg{body: m.body, headers: headers}); err != nil {
+			// 队列已满时放回原队列, 避免丢失消息
+			b.push(q, m)
+		}
+	}
+	if delay > 0 {
+		// 与amqp的延迟队列一致, 等待期间不占用worker
+		time.AfterFunc(delay, redeliver)
+		return
+	}
+	redeliver()
+}
+
+// Stop : 停止消费并等待处理中的消息完成, 内存实现无法中断处理中的消息, 超时后直接返回
+func (b *MemoryBroker) Stop(timeout time.Duration) {
+	b.stopOnce.Do(func() { close(b.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+// InFlight : 正在处理的消息数
+func (b *MemoryBroker) InFlight() int {
+	return int(b.inflight.Load())
+}
+
+func (b *MemoryBroker) ReplayErrQueue(errQName, qName string, limit int) (int, error) {
+	errQ, q := b.queue(errQName), b.queue(qName)
+	count := 0
+	for limit <= 0 || count < limit {
+		select {
+		case m := <-errQ:
+			if err := b.push(q, memoryMsg{body: m.body, headers: replayHeaders(m.headers)}); err != nil {
+				b.push(errQ, m)
+				return count, err
+			}
+			count++
+		default:
+			return count, nil
+		}
+	}
+	return count, nil
+}
+
+// Len : 队列中待消费的消息数
+func (b *MemoryBroker) Len(qName string) int {
+	return len(b.queue(qName))
+}
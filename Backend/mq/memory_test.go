@@ -0,0 +1,152 @@
+package mq
+
+import (
+	"cloud_distributed_storage/Backend/config"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	retryDelay = func(int) time.Duration { return 0 }
+}
+
+// consume : 在后台消费转移队列
+func consume(b *MemoryBroker, handler Handler) {
+	go b.Consume(config.TransS3QueueName, config.TransS3ErrQueueName, "test", 2, handler)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMemoryBrokerRetry(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(time.Second)
+
+	calls := make(chan []byte, 10)
+	retries := make(chan int, 10)
+	consume(b, func(msg []byte, n int) error {
+		retries <- n
+		calls <- msg
+		if len(calls) < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	assert.NoError(t, b.Publish(config.TransExchangeName, config.TransS3RoutingKey, []byte("job")))
+	waitFor(t, func() bool { return len(calls) == 3 })
+	assert.Equal(t, 0, b.Len(config.TransS3ErrQueueName))
+	for want := 0; want < 3; want++ {
+		assert.Equal(t, want, <-retries)
+	}
+}
+
+func TestMemoryBrokerErrQueueAndReplay(t *testing.T) {
+	b := NewMemoryBroker()
+	defer b.Stop(time.Second)
+
+	var fail atomic.Bool
+	fail.Store(true)
+	done := make(chan struct{}, 1)
+	consume(b, func(msg []byte, _ int) error {
+		if fail.Load() {
+			return Permanent(errors.New("bad message"))
+		}
+		done <- struct{}{}
+		return nil
+	})
+
+	assert.NoError(t, b.Publish(config.TransExchangeName, config.TransS3RoutingKey, []byte("job")))
+	waitFor(t, func() bool { return b.Len(config.TransS3ErrQueueName) == 1 })
+
+	errQ := b.queue(config.TransS3ErrQueueName)
+	m := <-errQ
+	assert.Equal(t, "bad message", m.headers[HeaderError])
+	assert.Equal(t, config.TransS3QueueName, m.headers[HeaderOriginalQueue])
+	errQ <- m
+
+	// 重放后重新处理成功
+	fail.Store(false)
+	n, err := b.ReplayErrQueue(config.TransS3ErrQueueName, config.TransS3QueueName, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("replayed message not consumed")
+	}
+}
+
+func TestMemoryBrokerUnroutable(t *testing.T) {
+	b := NewMemoryBroker()
+	assert.Error(t, b.Publish(config.TransExchangeName, "unknown", []byte("job")))
+}
+
+func TestMemoryBrokerGracefulStop(t *testing.T) {
+	b := NewMemoryBroker()
+
+	release := make(chan struct{})
+	var finished atomic.Int32
+	consume(b, func(msg []byte, _ int) error {
+		<-release
+		finished.Add(1)
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, b.Publish(config.TransExchangeName, config.TransS3RoutingKey, []byte("job")))
+	}
+	waitFor(t, func() bool { return b.InFlight() == 2 })
+
+	stopped := make(chan struct{})
+	go func() {
+		b.Stop(2 * time.Second)
+		close(stopped)
+	}()
+	close(release)
+	<-stopped
+	assert.Equal(t, int32(2), finished.Load())
+	assert.Equal(t, 0, b.InFlight())
+}
+
+// TestMemoryBrokerRetryDoesNotBlockWorker : 等待重试的消息不占用worker, 后续消息可立即处理
+func TestMemoryBrokerRetryDoesNotBlockWorker(t *testing.T) {
+	saved := retryDelay
+	retryDelay = func(int) time.Duration { return time.Hour }
+	defer func() { retryDelay = saved }()
+
+	b := NewMemoryBroker()
+	defer b.Stop(time.Second)
+
+	var ok atomic.Int32
+	go b.Consume(config.TransS3QueueName, config.TransS3ErrQueueName, "test", 1, func(msg []byte, _ int) error {
+		if string(msg) == "bad" {
+			return errors.New("temporary failure")
+		}
+		ok.Add(1)
+		return nil
+	})
+	assert.NoError(t, b.Publish(config.TransExchangeName, config.TransS3RoutingKey, []byte("bad")))
+	assert.NoError(t, b.Publish(config.TransExchangeName, config.TransS3RoutingKey, []byte("good")))
+	waitFor(t, func() bool { return ok.Load() == 1 })
+}
+
+func TestRetryQueues(t *testing.T) {
+	saved := retryDelay
+	retryDelay = func(retries int) time.Duration { return min(time.Second<<uint(retries), 4*time.Second) }
+	defer func() { retryDelay = saved }()
+
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, retryDelays())
+	assert.Equal(t, "q.retry.2000ms", retryQueueName("q", 2*time.Second))
+}
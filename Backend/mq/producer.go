@@ -1,25 +1,22 @@
 package mq
 
-import (
-	"cloud_distributed_storage/Backend/config"
-	"github.com/streadway/amqp"
-)
+import "cloud_distributed_storage/Backend/config"
 
-// Publish : 发布消息
-func Publish(exchange, routingKey string, msg []byte) bool {
-	if !initChannel(config.RabbitURL) {
-		return false
-	}
+// Publish : 发布消息, broker确认后才返回nil
+// 未确认的消息会保留在outbox中, 由后台定期及重连后重新发布
+func (b *amqpBroker) Publish(exchange, routingKey string, msg []byte) error {
+	initChannel(config.RabbitURL)
 
-	if nil == channel.Publish(
-		exchange,
-		routingKey,
-		false, // 如果没有对应的queue, 就会丢弃这条消息
-		false, //
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        msg}) {
-		return true
+	m := outboxMsg{exchange: exchange, routingKey: routingKey, body: msg}
+	err := publish(m)
+	if err != nil {
+		saveOutbox(m)
 	}
-	return false
+	return err
+}
+
+// publishRaw : 带消息头发布消息并等待确认, exchange为空时直接投递到名为routingKey的队列
+// 失败时不进入outbox, 由调用方拒绝原消息使其重新投递
+func publishRaw(exchange, routingKey string, msg []byte, headers map[string]interface{}) error {
+	return publish(outboxMsg{exchange: exchange, routingKey: routingKey, body: msg, headers: headers})
 }
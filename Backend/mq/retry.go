@@ -0,0 +1,88 @@
+package mq
+
+import (
+	"cloud_distributed_storage/Backend/config"
+	"fmt"
+	"log"
+	"time"
+)
+
+// retryDelay : 第retries次重试前的等待时间, 指数增长并有上限
+var retryDelay = func(retries int) time.Duration {
+	delay := config.TransRetryBaseDelay << uint(retries)
+	if delay <= 0 || delay > config.TransRetryMaxDelay {
+		delay = config.TransRetryMaxDelay
+	}
+	return delay
+}
+
+// retryQueueName : 等待delay后重试的延迟队列, 每个等待时间一个队列
+// 队列中的消息过期后经死信转回原队列qName, 等待期间不占用消费者
+func retryQueueName(qName string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", qName, delay.Milliseconds())
+}
+
+// retryDelays : 重试可能用到的全部等待时间, 升序且不重复
+func retryDelays() []time.Duration {
+	var delays []time.Duration
+	for retries := 0; retries < config.TransMaxRetries; retries++ {
+		delay := retryDelay(retries)
+		if delay > 0 && (len(delays) == 0 || delay > delays[len(delays)-1]) {
+			delays = append(delays, delay)
+		}
+	}
+	return delays
+}
+
+// routeFailure : 决定处理失败的消息的去向
+// 可重试时返回原队列及重试前的等待时间, 否则返回错误队列并在消息头中记录失败原因
+func routeFailure(headers map[string]interface{}, qName, errQName string, cause error) (string, map[string]interface{}, time.Duration) {
+	retries := retryCount(headers)
+	next := map[string]interface{}{}
+	for k, v := range headers {
+		next[k] = v
+	}
+
+	if IsPermanent(cause) || LastAttempt(retries) {
+		log.Printf("message moved to %s after %d retries: %v\n", errQName, retries, cause)
+		next[HeaderError] = cause.Error()
+		next[HeaderFailedAt] = time.Now().Format(time.RFC3339)
+		next[HeaderOriginalQueue] = qName
+		return errQName, next, 0
+	}
+
+	delay := retryDelay(retries)
+	log.Printf("message failed (retry %d/%d in %s): %v\n", retries+1, config.TransMaxRetries, delay, cause)
+	next[HeaderRetryCount] = int32(retries + 1)
+	return qName, next, delay
+}
+
+// replayHeaders : 重放时去掉重试次数及失败原因
+func replayHeaders(headers map[string]interface{}) map[string]interface{} {
+	next := map[string]interface{}{}
+	for k, v := range headers {
+		switch k {
+		case HeaderRetryCount, HeaderError, HeaderFailedAt, HeaderOriginalQueue:
+		default:
+			next[k] = v
+		}
+	}
+	return next
+}
+
+// LastAttempt : 已重试retries次的消息再次失败后是否转入错误队列, 不再重试
+func LastAttempt(retries int) bool {
+	return retries >= config.TransMaxRetries
+}
+
+func retryCount(headers map[string]interface{}) int {
+	switch v := headers[HeaderRetryCount].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
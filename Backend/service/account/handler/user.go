@@ -166,7 +166,7 @@ func (u *User) UserInfo(ctx context.Context, req *proto.ReqUserInfo, res *proto.
 		return nil
 	}
 
-	user := dbcli.ToTableUser(dbResp.Data)
+	user := dbResp.Data
 
 	// 3. 组装并且响应用户数据
 	res.Code = common.StatusOK
@@ -14,8 +14,7 @@ func (u *User) UserFiles(ctx context.Context, req *proto.ReqUserFiles, res *prot
 		res.Code = common.StatusServerError
 		return err
 	}
-	userFiles := dbcli.ToTableUserFiles(dbResp.Data)
-	data, err := json.Marshal(userFiles)
+	data, err := json.Marshal(dbResp.Data)
 	if err != nil {
 		res.Code = common.StatusServerError
 		return nil
@@ -31,14 +30,6 @@ func (u *User) UserFileRename(ctx context.Context, req *proto.ReqUserFileRename,
 		res.Code = common.StatusServerError
 		return err
 	}
-
-	userFiles := dbcli.ToTableUserFiles(dbResp.Data)
-	data, err := json.Marshal(userFiles)
-	if err != nil {
-		res.Code = common.StatusServerError
-		return nil
-	}
-
-	res.FileData = data
+	// 重命名不返回文件列表, 由apigw返回空列表
 	return nil
 }
@@ -1,14 +1,17 @@
 package client
 
 import (
+	"cloud_distributed_storage/Backend/common"
+	"cloud_distributed_storage/Backend/service/dbproxy/mapper"
 	"cloud_distributed_storage/Backend/service/dbproxy/orm"
 	dbProto "cloud_distributed_storage/Backend/service/dbproxy/proto"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/asim/go-micro/v3"
-	"github.com/mitchellh/mapstructure"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -20,6 +23,27 @@ type FileMeta struct {
 	UploadAt string
 }
 
+// Result : 单个操作的执行结果, Data的类型由操作决定
+type Result[T any] struct {
+	Suc  bool
+	Code int
+	Msg  string
+	Data T
+}
+
+// NotFound : 操作因记录不存在而失败
+func (r *Result[T]) NotFound() bool {
+	return r != nil && !r.Suc && r.Code == orm.CodeNotFound
+}
+
+// rawResult : 尚未按操作解码Data的执行结果
+type rawResult struct {
+	Suc  bool            `json:"suc"`
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
 var (
 	dbCli       dbProto.DBProxyService
 	initialized bool
@@ -30,6 +54,42 @@ func Init(service micro.Service) {
 	dbCli = dbProto.NewDBProxyService("go.micro.service.dbproxy", service.Client())
 	initialized = true
 	log.Println("DBProxy client initialized")
+
+	// dbproxy可能晚于当前服务启动, 自检在后台重试
+	go func() {
+		var err error
+		for i := 0; i < 10; i++ {
+			if err = SelfCheck(); err == nil {
+				log.Println("DBProxy client self-check passed")
+				return
+			}
+			time.Sleep(3 * time.Second)
+		}
+		log.Printf("DBProxy client self-check failed: %v", err)
+	}()
+}
+
+// SelfCheck : 检查客户端可调用的每个操作都已在dbproxy服务端注册
+// 客户端与服务端版本不一致时, 缺失的操作会在这里而不是在调用时暴露
+func SelfCheck() error {
+	res, err := call(mapper.Routes, struct{}{})
+	if err != nil {
+		return err
+	}
+	registered := make(map[string]bool, len(res.Data))
+	for _, name := range res.Data {
+		registered[name] = true
+	}
+	var missing []string
+	for _, name := range mapper.Names() {
+		if !registered[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("routes not registered in dbproxy: %s", strings.Join(missing, ", "))
+	}
+	return nil
 }
 
 func TableFileToFileMeta(tfile orm.TableFile) FileMeta {
@@ -41,244 +101,342 @@ func TableFileToFileMeta(tfile orm.TableFile) FileMeta {
 	}
 }
 
-// execAction : send request to dbproxy to execute action
-func execAction(funcName string, paramJson []byte) (*dbProto.ResExec, error) {
+// execActions : 在一次请求中执行多个操作, 操作调用失败(如参数无效)时返回error
+// transaction为true时所有操作在同一事务中执行, 任一操作失败则全部回滚并返回错误
+func execActions(sequence, transaction bool, actions ...*dbProto.SingleAction) ([]rawResult, error) {
 	if !initialized {
 		return nil, errors.New("DBProxy client not initialized")
 	}
 
-	log.Printf("Executing action: %s with params: %s", funcName, string(paramJson))
-
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	res, err := dbCli.ExecuteAction(ctx, &dbProto.ReqExec{
-		Actions: []*dbProto.SingleAction{
-			{
-				Name:   funcName,
-				Params: paramJson,
-			},
-		},
+		Sequence:    sequence,
+		Transaction: transaction,
+		Actions:     actions,
 	})
-
 	if err != nil {
-		log.Printf("Error executing action %s: %v", funcName, err)
+		log.Printf("Error executing %d actions: %v", len(actions), err)
 		return nil, err
 	}
 
-	log.Printf("Action %s executed successfully", funcName)
-	return res, nil
+	resList := []rawResult{}
+	if err = json.Unmarshal(res.Data, &resList); err != nil {
+		return nil, err
+	}
+	if res.Code != 0 {
+		return resList, errors.New(res.Msg)
+	}
+	return resList, nil
 }
 
-// parseBody : parse response rpc body
-func parseBody(res *dbProto.ResExec) *orm.ExecResult {
-	if res == nil || res.Data == nil {
-		log.Println("parseBody: res or res.Data is nil")
-		return nil
+// newAction : 构造批量执行中的一个操作
+func newAction[Req, Res any](a mapper.Action[Req, Res], req Req) (*dbProto.SingleAction, error) {
+	params, err := a.Params(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", a.Name, err)
 	}
-	resList := []orm.ExecResult{}
-	err := json.Unmarshal(res.Data, &resList)
+	return &dbProto.SingleAction{Name: a.Name, Params: params}, nil
+}
+
+// call : 执行单个操作并将结果解码为操作声明的类型
+// orm操作失败时返回Suc为false的结果, 请求或解码失败时返回error
+func call[Req, Res any](a mapper.Action[Req, Res], req Req) (*Result[Res], error) {
+	action, err := newAction(a, req)
 	if err != nil {
-		log.Printf("parseBody: json.Unmarshal failed, err:%v", err)
-		return nil
+		return nil, err
+	}
+	resList, err := execActions(false, false, action)
+	if err != nil {
+		log.Printf("Error executing action %s: %v", a.Name, err)
+		return nil, err
+	}
+	if len(resList) == 0 {
+		return nil, fmt.Errorf("%s: empty result", a.Name)
 	}
 
-	if len(resList) > 0 {
-		return &resList[0]
+	res := &Result[Res]{Suc: resList[0].Suc, Code: resList[0].Code, Msg: resList[0].Msg}
+	if res.Suc {
+		if res.Data, err = a.Result(resList[0].Data); err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	return res, nil
 }
 
-func ToTableUser(src interface{}) orm.TableUser {
-	user := orm.TableUser{}
-	_ = mapstructure.Decode(src, &user)
-	return user
+func GetFileMeta(filehash string) (*Result[orm.TableFile], error) {
+	return call(mapper.GetFileMeta, mapper.FileReq{FileHash: filehash})
 }
 
-func ToTableFile(src interface{}) orm.TableFile {
-	file := orm.TableFile{}
-	_ = mapstructure.Decode(src, &file)
-	return file
+// GetFileRecord : 查询文件记录, 不论文件状态; 记录不存在时NotFound返回true
+func GetFileRecord(filehash string) (*Result[orm.TableFile], error) {
+	return call(mapper.GetFileRecord, mapper.FileReq{FileHash: filehash})
 }
 
-func ToTableFiles(src interface{}) []orm.TableFile {
-	var files []orm.TableFile
-	_ = mapstructure.Decode(src, &files)
-	return files
+// GetFileMetaList : 按id升序分批查询可用文件, afterID为上一批最后一条记录的id
+func GetFileMetaList(afterID int64, limit int) (*Result[[]orm.TableFile], error) {
+	return call(mapper.GetFileMetaList, mapper.FileMetaListReq{AfterID: afterID, Limit: int64(limit)})
 }
 
-func ToTableUserFile(src interface{}) orm.TableUserFile {
-	userFile := orm.TableUserFile{}
-	_ = mapstructure.Decode(src, &userFile)
-	return userFile
+func UpdateUserFileDownloadCount(username, filehash string) (*Result[struct{}], error) {
+	return call(mapper.UpdateUserFileDownloadCount, mapper.UserFileReq{UserName: username, FileHash: filehash})
 }
 
-func ToTableUserFiles(src interface{}) []orm.TableUserFile {
-	var userFiles []orm.TableUserFile
-	_ = mapstructure.Decode(src, &userFiles)
-	return userFiles
+// OnFileUploadFinished : when file upload finished, save file meta to db
+func OnFileUploadFinished(fmeta FileMeta) (*Result[struct{}], error) {
+	return call(mapper.OnFileUploadFinished, fileUploadReq(fmeta))
 }
 
-func GetFileMeta(filehash string) (*orm.ExecResult, error) {
-	uInfo, err := json.Marshal([]string{filehash})
-	res, err := execAction("/file/GetFileMeta", uInfo)
-	if err != nil {
-		return nil, err
+func fileUploadReq(fmeta FileMeta) mapper.OnFileUploadFinishedReq {
+	return mapper.OnFileUploadFinishedReq{
+		FileHash: fmeta.FileSha1,
+		FileName: fmeta.FileName,
+		FileSize: fmeta.FileSize,
+		FileAddr: fmeta.Location,
 	}
-	return parseBody(res), nil
 }
 
-func GetFileMetaList(limit int) (*orm.ExecResult, error) {
-	uInfo, err := json.Marshal([]int{limit})
-	res, err := execAction("/file/GetFileMetaList", uInfo)
+func UpdateFileLocation(filehash, location string) (*Result[struct{}], error) {
+	return call(mapper.UpdateFileLocation, mapper.FileAddrReq{FileHash: filehash, FileAddr: location})
+}
+
+func UserSignup(username, encPasswd, email, phone string) (*Result[struct{}], error) {
+	return call(mapper.UserSignup, mapper.UserSignupReq{UserName: username, Passwd: encPasswd, Email: email, Phone: phone})
+}
+
+func UserLogin(username, encPasswd string) (*Result[int64], error) {
+	return call(mapper.UserLogin, mapper.UserLoginReq{UserName: username, EncPwd: encPasswd})
+}
+
+func UserLogout(username string) (*Result[struct{}], error) {
+	return call(mapper.UserLogout, mapper.UserReq{UserName: username})
+}
+
+func DeleteUserAccount(username string) (*Result[struct{}], error) {
+	return call(mapper.DeleteUserAccount, mapper.UserReq{UserName: username})
+}
+
+func GetUserInfo(username string) (*Result[orm.TableUser], error) {
+	return call(mapper.GetUserInfo, mapper.UserReq{UserName: username})
+}
+
+func UserExist(username string) (*Result[bool], error) {
+	return call(mapper.UserExist, mapper.UserReq{UserName: username})
+}
+
+func UpdateToken(username, token string) (*Result[struct{}], error) {
+	return call(mapper.UpdateToken, mapper.UpdateTokenReq{UserName: username, Token: token})
+}
+
+func QueryUserFileMeta(username, filehash string) (*Result[orm.TableUserFile], error) {
+	return call(mapper.QueryUserFileMeta, mapper.UserFileReq{UserName: username, FileHash: filehash})
+}
+
+func QueryUserFileMetas(username string, limit int) (*Result[[]orm.TableUserFile], error) {
+	return call(mapper.QueryUserFileMetas, mapper.UserLimitReq{UserName: username, Limit: int64(limit)})
+}
+
+// OnUploadFinished : 在同一事务中写入文件表及用户文件表, 不会出现只写入其中一张表的情况
+func OnUploadFinished(username string, fmeta FileMeta) error {
+	fileAction, err := newAction(mapper.OnFileUploadFinished, fileUploadReq(fmeta))
 	if err != nil {
-		return nil, err
+		return err
+	}
+	userFileAction, err := newAction(mapper.OnUserFileUploadFinished, userFileUploadReq(username, fmeta))
+	if err != nil {
+		return err
+	}
+	resList, err := execActions(true, true, fileAction, userFileAction)
+	if err != nil {
+		return err
 	}
-	return parseBody(res), nil
+	for _, res := range resList {
+		if !res.Suc {
+			return errors.New(res.Msg)
+		}
+	}
+	return nil
 }
 
-func UpdateUserFileDownloadCount(username, filehash string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username, filehash})
-	res, err := execAction("/file/UpdateUserFileDownloadCount", uInfo)
-	return parseBody(res), err
+func OnUserFileUploadFinished(username string, fmeta FileMeta) (*Result[struct{}], error) {
+	return call(mapper.OnUserFileUploadFinished, userFileUploadReq(username, fmeta))
 }
 
-// OnFileUploadFinished : when file upload finished, save file meta to db
-func OnFileUploadFinished(fmeta FileMeta) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{fmeta.FileSha1, fmeta.FileName, fmeta.FileSize, fmeta.Location})
-	res, err := execAction("/file/OnFileUploadFinished", uInfo)
-	return parseBody(res), err
+func userFileUploadReq(username string, fmeta FileMeta) mapper.OnUserFileUploadFinishedReq {
+	return mapper.OnUserFileUploadFinishedReq{
+		UserName: username,
+		FileHash: fmeta.FileSha1,
+		FileName: fmeta.FileName,
+		FileSize: fmeta.FileSize,
+	}
+}
+
+func DeleteUserFile(username, filehash string) (*Result[struct{}], error) {
+	return call(mapper.DeleteUserFile, mapper.UserFileReq{UserName: username, FileHash: filehash})
 }
 
-func UpdateFileLocation(filehash, location string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{filehash, location})
-	res, err := execAction("/file/UpdateFileLocation", uInfo)
-	return parseBody(res), err
+// RestoreUserFile : 从回收站恢复用户已删除的文件
+func RestoreUserFile(username, filehash string) (*Result[struct{}], error) {
+	return call(mapper.RestoreUserFile, mapper.UserFileReq{UserName: username, FileHash: filehash})
 }
 
-func UserSignup(username, encPasswd, email, phone string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username, encPasswd, email, phone})
-	res, err := execAction("/user/UserSignup", uInfo)
-	return parseBody(res), err
+// QueryUserFilesByStatus : 按状态查询用户文件, status为common.UserFileDeleted时即回收站列表
+func QueryUserFilesByStatus(username string, status common.UserFileStatus, limit int) (*Result[[]orm.TableUserFile], error) {
+	return call(mapper.QueryUserFilesByStatus, mapper.UserFilesByStatusReq{UserName: username, Status: status, Limit: int64(limit)})
 }
 
-func UserLogin(username, encPasswd string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username, encPasswd})
-	res, err := execAction("/user/UserLogin", uInfo)
-	return parseBody(res), err
+func RenameFileName(username, filehash, filename string) (*Result[struct{}], error) {
+	return call(mapper.UpdateUserFileName, mapper.RenameFileReq{UserName: username, FileHash: filehash, FileName: filename})
 }
 
-func UserLogout(username string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username})
-	res, err := execAction("/user/UserLogout", uInfo)
-	return parseBody(res), err
+func CreateRole(roleName, description string) (*Result[struct{}], error) {
+	return call(mapper.CreateRole, mapper.CreateRoleReq{RoleName: roleName, Description: description})
 }
 
-func DeleteUserAccount(username string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username})
-	res, err := execAction("/user/DeleteUserAccount", uInfo)
-	return parseBody(res), err
+func ListRoles() (*Result[[]orm.TableRole], error) {
+	return call(mapper.ListRoles, struct{}{})
 }
 
-func GetUserInfo(username string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username})
-	res, err := execAction("/user/GetUserInfo", uInfo)
-	return parseBody(res), err
+func GetRoleInfo(roleName string) (*Result[orm.TableRole], error) {
+	return call(mapper.GetRoleInfo, mapper.RoleReq{RoleName: roleName})
 }
 
-func UserExist(username string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username})
-	res, err := execAction("/user/UserExist", uInfo)
-	return parseBody(res), err
+func UpdateRole(roleName, newRoleName, description string) (*Result[struct{}], error) {
+	return call(mapper.UpdateRole, mapper.UpdateRoleReq{RoleName: roleName, NewRoleName: newRoleName, Description: description})
 }
 
-func UpdateToken(username, token string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username, token})
-	res, err := execAction("/user/UpdateToken", uInfo)
-	return parseBody(res), err
+func DeleteRole(roleName string) (*Result[struct{}], error) {
+	return call(mapper.DeleteRole, mapper.RoleReq{RoleName: roleName})
 }
 
-func QueryUserFileMeta(username, filehash string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username, filehash})
-	res, err := execAction("/ufile/QueryUserFileMeta", uInfo)
-	return parseBody(res), err
+func AssignRoleToUser(username, roleName string) (*Result[struct{}], error) {
+	return call(mapper.AssignRole, mapper.UserRoleReq{UserName: username, RoleName: roleName})
 }
 
-func QueryUserFileMetas(username string, limit int) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username, limit})
-	res, err := execAction("/ufile/QueryUserFileMetas", uInfo)
-	return parseBody(res), err
+func RemoveRoleFromUser(username, roleName string) (*Result[struct{}], error) {
+	return call(mapper.RemoveRole, mapper.UserRoleReq{UserName: username, RoleName: roleName})
 }
 
-func OnUserFileUploadFinished(username string, fmeta FileMeta) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username, fmeta.FileSha1,
-		fmeta.FileName, fmeta.FileSize})
-	res, err := execAction("/ufile/OnUserFileUploadFinished", uInfo)
-	return parseBody(res), err
+func GetUserRoles(username string) (*Result[[]orm.TableRole], error) {
+	return call(mapper.GetUserRoles, mapper.UserReq{UserName: username})
+}
+
+func GetRoleUsers(roleName string) (*Result[[]orm.TableUser], error) {
+	return call(mapper.GetRoleUsers, mapper.RoleReq{RoleName: roleName})
+}
+
+func GrantPermission(roleName, username, filehash string, permRead, permWrite, permDelete, permShare bool, expireTime *time.Time) (*Result[struct{}], error) {
+	return call(mapper.GrantPermission, mapper.GrantPermissionReq{
+		RoleName:   roleName,
+		UserName:   username,
+		FileHash:   filehash,
+		PermRead:   permRead,
+		PermWrite:  permWrite,
+		PermDelete: permDelete,
+		PermShare:  permShare,
+		ExpireTime: expireTime,
+	})
 }
 
-func RenameFileName(username, filehash, filename string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username, filehash, filename})
-	res, err := execAction("/ufile/RenameFileName", uInfo)
-	return parseBody(res), err
+func RevokePermission(roleName, username, filehash string) (*Result[struct{}], error) {
+	return call(mapper.RevokePermission, mapper.RevokePermissionReq{RoleName: roleName, UserName: username, FileHash: filehash})
+}
+
+func CheckPermission(username, filehash string) (*Result[map[string]bool], error) {
+	return call(mapper.CheckPermission, mapper.UserFileReq{UserName: username, FileHash: filehash})
+}
+
+func ListUserPermissions(username string) (*Result[[]map[string]interface{}], error) {
+	return call(mapper.ListUserPermissions, mapper.UserReq{UserName: username})
+}
+
+// AcquireChunk : 引用已存在的分块, Data为分块地址, 分块不存在时为空
+func AcquireChunk(chunkHash string) (*Result[string], error) {
+	return call(mapper.AcquireChunk, mapper.ChunkReq{ChunkHash: chunkHash})
+}
+
+// AddChunk : 记录新上传的分块, Data为最终生效的分块地址
+func AddChunk(chunkHash string, chunkSize int64, chunkAddr string) (*Result[string], error) {
+	return call(mapper.AddChunk, mapper.AddChunkReq{ChunkHash: chunkHash, ChunkSize: chunkSize, ChunkAddr: chunkAddr})
+}
+
+// UnrefChunks : 归还分块的引用, Data为不再被引用的分块地址
+func UnrefChunks(chunkHashes []string) (*Result[[]string], error) {
+	return call(mapper.UnrefChunks, mapper.ChunksReq{ChunkHashes: chunkHashes})
+}
+
+// AddFileChunks : 保存文件的分块清单, 文件已有清单时Data为不再被引用的分块地址
+func AddFileChunks(filehash string, chunks []orm.TableFileChunk) (*Result[[]string], error) {
+	manifest, err := json.Marshal(chunks)
+	if err != nil {
+		return nil, err
+	}
+	return call(mapper.AddFileChunks, mapper.AddFileChunksReq{FileHash: filehash, Manifest: string(manifest)})
+}
+
+func GetFileChunks(filehash string) (*Result[[]orm.TableFileChunk], error) {
+	return call(mapper.GetFileChunks, mapper.FileReq{FileHash: filehash})
+}
+
+// ReleaseFileChunks : 释放文件的分块清单, Data为不再被引用的分块地址
+func ReleaseFileChunks(filehash string) (*Result[[]string], error) {
+	return call(mapper.ReleaseFileChunks, mapper.FileReq{FileHash: filehash})
+}
+
+// CreateTransferJob : 记录一条排队中的转移任务, 成功时Data为任务id
+func CreateTransferJob(filehash, username, srcAddr, destAddr string, destStoreType common.StoreType) (*Result[int64], error) {
+	return call(mapper.CreateTransferJob, mapper.CreateTransferJobReq{
+		FileHash:      filehash,
+		UserName:      username,
+		SrcAddr:       srcAddr,
+		DestAddr:      destAddr,
+		DestStoreType: destStoreType,
+	})
 }
 
-func GetRoleInfo(roleName string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{roleName})
-	res, err := execAction("/role/GetRoleInfo", uInfo)
-	return parseBody(res), err
+func UpdateTransferJob(jobID int64, status common.TransferStatus, lastError string) (*Result[struct{}], error) {
+	return call(mapper.UpdateTransferJob, mapper.UpdateTransferJobReq{JobID: jobID, Status: status, LastError: lastError})
 }
 
-func UpdateRole(roleName, newRoleName, description string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{roleName, newRoleName, description})
-	res, err := execAction("/role/UpdateRole", uInfo)
-	return parseBody(res), err
+// GetTransferJobsByFile : 查询username对该文件发起的转移任务
+func GetTransferJobsByFile(username, filehash string) (*Result[[]orm.TableTransferJob], error) {
+	return call(mapper.GetTransferJobsByFile, mapper.UserFileReq{UserName: username, FileHash: filehash})
 }
 
-func DeleteRole(roleName string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{roleName})
-	res, err := execAction("/role/DeleteRole", uInfo)
-	return parseBody(res), err
+func GetTransferJobsByUser(username string, limit int) (*Result[[]orm.TableTransferJob], error) {
+	return call(mapper.GetTransferJobsByUser, mapper.UserLimitReq{UserName: username, Limit: int64(limit)})
 }
 
-func AssignRoleToUser(username, roleName string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username, roleName})
-	res, err := execAction("/role/AssignRoleToUser", uInfo)
-	return parseBody(res), err
+// AddFileReplica : 记录文件在storeType存储中的副本地址
+func AddFileReplica(filehash, fileaddr string, storeType common.StoreType) (*Result[struct{}], error) {
+	return call(mapper.AddFileReplica, mapper.AddFileReplicaReq{FileHash: filehash, FileAddr: fileaddr, StoreType: storeType})
 }
 
-func RemoveRoleFromUser(username, roleName string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username, roleName})
-	res, err := execAction("/role/RemoveRoleFromUser", uInfo)
-	return parseBody(res), err
+func GetFileReplicas(filehash string) (*Result[[]orm.TableFileReplica], error) {
+	return call(mapper.GetFileReplicas, mapper.FileReq{FileHash: filehash})
 }
 
-func GetUserRoles(username string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username})
-	res, err := execAction("/role/GetUserRoles", uInfo)
-	return parseBody(res), err
+func RemoveFileReplica(filehash, fileaddr string) (*Result[struct{}], error) {
+	return call(mapper.RemoveFileReplica, mapper.FileAddrReq{FileHash: filehash, FileAddr: fileaddr})
 }
 
-func GrantPermission(roleName, username, filehash string, permRead, permWrite, permDelete, permShare bool, expireTime *time.Time) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{roleName, username, filehash, permRead, permWrite, permDelete, permShare, expireTime})
-	res, err := execAction("/permission/GrantPermission", uInfo)
-	return parseBody(res), err
+// GetColdFiles : 查询存储在addrPrefix下、before之后无人访问的文件
+func GetColdFiles(addrPrefix string, before time.Time, limit int) (*Result[[]orm.TableFile], error) {
+	return call(mapper.GetColdFiles, mapper.ColdFilesReq{AddrPrefix: addrPrefix, Before: before, Limit: int64(limit)})
 }
 
-func RevokePermission(roleName, username, filehash string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{roleName, username, filehash})
-	res, err := execAction("/permission/RevokePermission", uInfo)
-	return parseBody(res), err
+// GetExpiredUserFiles : 查询before之前被用户删除的文件记录
+func GetExpiredUserFiles(before time.Time, limit int) (*Result[[]orm.TableUserFile], error) {
+	return call(mapper.GetExpiredUserFiles, mapper.ExpiredUserFilesReq{Before: before, Limit: int64(limit)})
 }
 
-func CheckPermission(username, filehash string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username, filehash})
-	res, err := execAction("/permission/CheckPermission", uInfo)
-	return parseBody(res), err
+// PurgeUserFile : 彻底删除用户已删除的文件, 文件不再被引用时Data为其file_addr
+func PurgeUserFile(username, filehash string) (*Result[string], error) {
+	return call(mapper.PurgeUserFile, mapper.UserFileReq{UserName: username, FileHash: filehash})
 }
 
-func ListUserPermissions(username string) (*orm.ExecResult, error) {
-	uInfo, _ := json.Marshal([]interface{}{username})
-	res, err := execAction("/permission/ListUserPermissions", uInfo)
-	return parseBody(res), err
+// UpdateFileStatus : 更新文件状态
+func UpdateFileStatus(filehash string, status common.FileStatus) (*Result[struct{}], error) {
+	return call(mapper.UpdateFileStatus, mapper.UpdateFileStatusReq{FileHash: filehash, Status: status})
 }
@@ -1,12 +1,98 @@
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
 
 var (
-	TiDBSource = "root:@tcp(localhost:4000)/fileserver?charset=utf8"
+	// TiDBSource : 主库dsn, 写操作及事务均在主库执行
+	TiDBSource = envOr("DBPROXY_PRIMARY_DSN", "root:@tcp(localhost:4000)/fileserver?charset=utf8")
+	// ReplicaSources : 只读副本dsn, 环境变量中以逗号分隔; 为空时读操作也在主库执行
+	ReplicaSources = splitList(os.Getenv("DBPROXY_REPLICA_DSNS"))
+
+	// MaxOpenConns : 每个数据库连接池的最大连接数
+	MaxOpenConns = envInt("DBPROXY_MAX_OPEN_CONNS", 200)
+	// MaxIdleConns : 每个数据库连接池保留的最大空闲连接数
+	MaxIdleConns = envInt("DBPROXY_MAX_IDLE_CONNS", 50)
+	// ConnMaxLifetime : 连接的最长使用时间, 到期后关闭重建, 便于负载均衡器重新分配连接
+	ConnMaxLifetime = envDuration("DBPROXY_CONN_MAX_LIFETIME", 30*time.Minute)
+	// ConnMaxIdleTime : 空闲连接的最长保留时间
+	ConnMaxIdleTime = envDuration("DBPROXY_CONN_MAX_IDLE_TIME", 5*time.Minute)
+)
+
+const (
+	// HeartbeatInterval : 主库写入心跳的间隔, 副本延迟以心跳时间计算
+	HeartbeatInterval = time.Second
+	// HealthCheckInterval : 检查各副本可用性及延迟的间隔, 须小于ReplicaMaxLag, 否则延迟超限的副本在两次检查之间仍会接收读请求
+	HealthCheckInterval = time.Second
+	// HealthCheckTimeout : 单次健康检查的超时时间
+	HealthCheckTimeout = 2 * time.Second
+	// ReplicaMaxLag : 副本延迟超过该值时不再接收读请求, 读请求回退到其他副本或主库
+	ReplicaMaxLag = 3 * time.Second
+
+	// HealthServiceHost : /health接口监听的地址
+	HealthServiceHost = "0.0.0.0:48080"
 )
 
+// UpdateDBHost : 使用命令行参数指定的地址替换主库dsn中的地址
 func UpdateDBHost(host string) {
-	TiDBSource = fmt.Sprintf("root:@tcp(%s:4000)/fileserver?charset=utf8", host)
-	fmt.Println("Updated TiDBSource:", TiDBSource) // Debug log
+	c, err := mysql.ParseDSN(TiDBSource)
+	if err != nil {
+		TiDBSource = fmt.Sprintf("root:@tcp(%s:4000)/fileserver?charset=utf8", host)
+	} else {
+		c.Addr = host + ":4000"
+		TiDBSource = c.FormatDSN()
+	}
+	fmt.Println("Updated TiDBSource:", RedactDSN(TiDBSource)) // Debug log
+}
+
+// RedactDSN : 隐藏dsn中的密码, 用于日志及健康检查输出
+func RedactDSN(dsn string) string {
+	c, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "invalid dsn"
+	}
+	if c.Passwd != "" {
+		c.Passwd = "***"
+	}
+	return c.FormatDSN()
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt : 读取整数环境变量, 未设置或格式错误时使用默认值
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// envDuration : 读取时长环境变量(如"30m"), 未设置或格式错误时使用默认值
+func envDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
 }
@@ -0,0 +1,6 @@
+package config
+
+const (
+	// AutoMigrate : dbproxy启动时自动执行未执行的schema迁移
+	AutoMigrate = true
+)
@@ -11,24 +11,45 @@ import (
 
 var db *sql.DB
 
+// InitDBConn : 连接主库并打开全部只读副本, 主库不可用时返回错误
+// 副本在MonitorReplicas检查通过前不接收读请求
 func InitDBConn() error {
 	var err error
-	db, err = sql.Open("mysql", cfg.TiDBSource)
+	db, err = open(cfg.TiDBSource)
 	if err != nil {
 		return fmt.Errorf("failed to open database: %v", err)
 	}
-
-	db.SetMaxOpenConns(1000)
 	err = db.Ping()
 	if err != nil {
 		return fmt.Errorf("failed to connect to TiDB: %v", err)
 	}
-
 	log.Println("Successfully connected to TiDB database")
+
+	replicas = replicas[:0]
+	for _, dsn := range cfg.ReplicaSources {
+		rdb, err := open(dsn)
+		if err != nil {
+			return fmt.Errorf("failed to open replica %s: %v", cfg.RedactDSN(dsn), err)
+		}
+		replicas = append(replicas, &replica{name: cfg.RedactDSN(dsn), db: rdb})
+	}
 	return nil
 }
 
-// DBConn 返回数据库连接对象
+// open : 按连接池配置打开数据库, 不会立即建立连接
+func open(dsn string) (*sql.DB, error) {
+	conn, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(cfg.MaxOpenConns)
+	conn.SetMaxIdleConns(cfg.MaxIdleConns)
+	conn.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	conn.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return conn, nil
+}
+
+// DBConn 返回主库连接对象
 func DBConn() *sql.DB {
 	return db
 }
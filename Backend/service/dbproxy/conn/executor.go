@@ -0,0 +1,41 @@
+package tidb
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Executor : *sql.DB与*sql.Tx的公共方法
+// orm函数通过Executor执行sql, 由mapper传入数据库连接或批量执行时的事务
+type Executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Prepare(query string) (*sql.Stmt, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Tx : orm函数内部使用的事务
+type Tx interface {
+	Executor
+	Commit() error
+	Rollback() error
+}
+
+// Begin : 在ex上开启事务; ex本身已是事务时直接复用, 提交与回滚由外层事务负责
+func Begin(ex Executor) (Tx, error) {
+	switch e := ex.(type) {
+	case *sql.DB:
+		return e.Begin()
+	case *sql.Tx:
+		return nestedTx{e}, nil
+	}
+	return nil, fmt.Errorf("unsupported executor %T", ex)
+}
+
+// nestedTx : 外层事务中的子事务, Commit与Rollback均不生效
+type nestedTx struct {
+	*sql.Tx
+}
+
+func (nestedTx) Commit() error   { return nil }
+func (nestedTx) Rollback() error { return nil }
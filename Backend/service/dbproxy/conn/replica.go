@@ -0,0 +1,184 @@
+package tidb
+
+import (
+	cfg "cloud_distributed_storage/Backend/service/dbproxy/config"
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replica : 一个只读副本及其最近一次健康检查的结果
+type replica struct {
+	name string
+	db   *sql.DB
+
+	mu        sync.RWMutex
+	available bool
+	lag       time.Duration
+	lastErr   string
+	checkedAt time.Time
+}
+
+var (
+	replicas []*replica
+	next     uint32
+)
+
+// ReadConn : 返回执行只读操作的连接
+// 在可用且延迟不超过ReplicaMaxLag的副本间轮询; 没有这样的副本时返回主库
+func ReadConn() *sql.DB {
+	n := len(replicas)
+	if n == 0 {
+		return db
+	}
+	start := atomic.AddUint32(&next, 1)
+	for i := 0; i < n; i++ {
+		r := replicas[(int(start)+i)%n]
+		r.mu.RLock()
+		ok := r.available
+		r.mu.RUnlock()
+		if ok {
+			return r.db
+		}
+	}
+	return db
+}
+
+// ReplicaStatus : 副本的健康状态
+type ReplicaStatus struct {
+	Name      string    `json:"name"`
+	Available bool      `json:"available"`
+	LagMillis int64     `json:"lag_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// HealthStatus : 主库及各副本的健康状态
+type HealthStatus struct {
+	Primary      bool            `json:"primary"`
+	PrimaryError string          `json:"primary_error,omitempty"`
+	OpenConns    int             `json:"open_conns"`
+	InUse        int             `json:"in_use"`
+	Replicas     []ReplicaStatus `json:"replicas"`
+}
+
+// Health : 检查主库连通性并返回副本最近一次检查的结果
+func Health(ctx context.Context) HealthStatus {
+	ctx, cancel := context.WithTimeout(ctx, cfg.HealthCheckTimeout)
+	defer cancel()
+
+	var status HealthStatus
+	if db == nil {
+		status.PrimaryError = "not initialized"
+		return status
+	}
+	if err := db.PingContext(ctx); err != nil {
+		status.PrimaryError = err.Error()
+	} else {
+		status.Primary = true
+	}
+	stats := db.Stats()
+	status.OpenConns = stats.OpenConnections
+	status.InUse = stats.InUse
+
+	status.Replicas = make([]ReplicaStatus, 0, len(replicas))
+	for _, r := range replicas {
+		r.mu.RLock()
+		status.Replicas = append(status.Replicas, ReplicaStatus{
+			Name:      r.name,
+			Available: r.available,
+			LagMillis: r.lag.Milliseconds(),
+			Error:     r.lastErr,
+			CheckedAt: r.checkedAt,
+		})
+		r.mu.RUnlock()
+	}
+	return status
+}
+
+// MonitorReplicas : 立即检查一次各副本, 之后在后台定期写入心跳并检查副本
+// 依赖tbl_heartbeat, 应在数据库迁移完成后调用; 没有配置副本时不做任何事
+func MonitorReplicas() {
+	if len(replicas) == 0 {
+		return
+	}
+	writeHeartbeat()
+	checkReplicas()
+	go monitor()
+}
+
+func monitor() {
+	heartbeat := time.NewTicker(cfg.HeartbeatInterval)
+	check := time.NewTicker(cfg.HealthCheckInterval)
+	defer heartbeat.Stop()
+	defer check.Stop()
+	for {
+		select {
+		case <-heartbeat.C:
+			writeHeartbeat()
+		case <-check.C:
+			checkReplicas()
+		}
+	}
+}
+
+// writeHeartbeat : 在主库写入当前时间, 副本复制到该行后即可据此计算延迟
+func writeHeartbeat() {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HealthCheckTimeout)
+	defer cancel()
+	_, err := db.ExecContext(ctx, "UPDATE tbl_heartbeat SET ts = ? WHERE id = 1", time.Now().UnixMilli())
+	if err != nil {
+		log.Println("Failed to write heartbeat, err: ", err.Error())
+	}
+}
+
+func checkReplicas() {
+	var wg sync.WaitGroup
+	for _, r := range replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			r.check()
+		}(r)
+	}
+	wg.Wait()
+}
+
+// check : 读取副本上的心跳计算延迟, 不可达或延迟超过ReplicaMaxLag时停止向其分配读请求
+func (r *replica) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HealthCheckTimeout)
+	defer cancel()
+
+	var ts int64
+	err := r.db.QueryRowContext(ctx, "SELECT ts FROM tbl_heartbeat WHERE id = 1").Scan(&ts)
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wasAvailable := r.available
+	r.checkedAt = now
+	r.lastErr = ""
+	if err != nil {
+		r.available = false
+		r.lastErr = err.Error()
+	} else {
+		r.lag = lagOf(now, ts)
+		r.available = r.lag <= cfg.ReplicaMaxLag
+	}
+	if wasAvailable != r.available {
+		log.Printf("replica %s available: %v, lag: %v, err: %s\n", r.name, r.available, r.lag, r.lastErr)
+	}
+}
+
+// lagOf : 副本上心跳时间ts(unix毫秒)相对now的延迟
+func lagOf(now time.Time, ts int64) time.Duration {
+	lag := now.Sub(time.UnixMilli(ts))
+	if lag < 0 {
+		// dbproxy实例间的时钟偏差
+		return 0
+	}
+	return lag
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"cloud_distributed_storage/Backend/service/dbproxy/config"
+	dbConn "cloud_distributed_storage/Backend/service/dbproxy/conn"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startHealthService : 提供/health接口, 返回主库及各副本的健康状态, 主库不可用时返回503
+func startHealthService() {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/health", func(c *gin.Context) {
+		status := dbConn.Health(c.Request.Context())
+		code := http.StatusOK
+		if !status.Primary {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, status)
+	})
+	router.Run(config.HealthServiceHost)
+}
@@ -4,6 +4,7 @@ import (
 	"cloud_distributed_storage/Backend/common"
 	"cloud_distributed_storage/Backend/service/dbproxy/config"
 	dbConn "cloud_distributed_storage/Backend/service/dbproxy/conn"
+	"cloud_distributed_storage/Backend/service/dbproxy/migrate"
 	dbProxy "cloud_distributed_storage/Backend/service/dbproxy/proto"
 	dbRpc "cloud_distributed_storage/Backend/service/dbproxy/rpc"
 	"github.com/asim/go-micro/plugins/registry/consul/v3"
@@ -11,6 +12,7 @@ import (
 	"github.com/asim/go-micro/v3/registry"
 	"github.com/urfave/cli/v2"
 	"log"
+	"os"
 	"time"
 )
 
@@ -38,7 +40,21 @@ func startRpcService() {
 		}),
 	)
 	// Init db connection
-	dbConn.InitDBConn()
+	if err := migrate.EnsureDatabase(config.TiDBSource); err != nil {
+		log.Fatalf("failed to create database: %v", err)
+	}
+	if err := dbConn.InitDBConn(); err != nil {
+		log.Fatalf("failed to init db connection: %v", err)
+	}
+	if err := autoMigrate(); err != nil {
+		log.Fatalf("failed to migrate database: %v", err)
+	}
+	log.Println("primary: ", config.RedactDSN(config.TiDBSource))
+	for _, dsn := range config.ReplicaSources {
+		log.Println("replica: ", config.RedactDSN(dsn))
+	}
+	dbConn.MonitorReplicas()
+	go startHealthService()
 
 	// Register handler
 	err := dbProxy.RegisterDBProxyServiceHandler(service.Server(), new(dbRpc.DBProxy))
@@ -53,5 +69,11 @@ func startRpcService() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	startRpcService()
 }
@@ -0,0 +1,98 @@
+package mapper
+
+import (
+	"bytes"
+	mydb "cloud_distributed_storage/Backend/service/dbproxy/conn"
+	"cloud_distributed_storage/Backend/service/dbproxy/orm"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Action : 一个dbproxy操作, Req为请求参数类型, Res为执行成功时ExecResult.Data的类型
+// 服务端与客户端共用同一个Action, 参数与结果类型在编译期即可检查
+type Action[Req, Res any] struct {
+	Name string
+	call func(ex mydb.Executor, req Req) orm.ExecResult
+}
+
+// Params : 将请求参数编码为SingleAction.Params
+func (a Action[Req, Res]) Params(req Req) ([]byte, error) {
+	return json.Marshal(req)
+}
+
+// Result : 将ExecResult.Data解码为Res
+func (a Action[Req, Res]) Result(data json.RawMessage) (Res, error) {
+	var res Res
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return res, nil
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return res, fmt.Errorf("%s: invalid result: %w", a.Name, err)
+	}
+	return res, nil
+}
+
+// invoke : 解码参数并调用orm函数
+func (a Action[Req, Res]) invoke(ex mydb.Executor, params []byte) (orm.ExecResult, error) {
+	var req Req
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return orm.ExecResult{}, fmt.Errorf("%s: invalid params: %w", a.Name, err)
+	}
+	return a.call(ex, req), nil
+}
+
+type invoker interface {
+	invoke(ex mydb.Executor, params []byte) (orm.ExecResult, error)
+}
+
+var (
+	actions = map[string]invoker{}
+	// readOnly : 只读操作, 可在只读副本上执行
+	readOnly = map[string]bool{}
+)
+
+// register : 注册一个操作, 名称重复时panic
+func register[Req, Res any](name string, call func(ex mydb.Executor, req Req) orm.ExecResult) Action[Req, Res] {
+	if _, ok := actions[name]; ok {
+		panic("mapper: duplicate action " + name)
+	}
+	a := Action[Req, Res]{Name: name, call: call}
+	actions[name] = a
+	return a
+}
+
+// registerRead : 注册一个只读操作, 非事务请求中全部为只读操作时由副本执行
+// 副本存在复制延迟, 读后立即校验写入结果的操作(如UserLogin)不应注册为只读
+func registerRead[Req, Res any](name string, call func(ex mydb.Executor, req Req) orm.ExecResult) Action[Req, Res] {
+	a := register[Req, Res](name, call)
+	readOnly[name] = true
+	return a
+}
+
+// ReadOnly : name是否为只读操作, 未注册的操作返回false
+func ReadOnly(name string) bool {
+	return readOnly[name]
+}
+
+// Names : 已注册的全部操作名称, 按名称排序
+func Names() []string {
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FunCall : 按名称执行操作, ex为数据库连接或事务, params为json编码的请求参数
+// 操作不存在或参数无法解码时返回error, orm函数本身的失败体现在ExecResult中
+func FunCall(ex mydb.Executor, name string, params []byte) (res orm.ExecResult, err error) {
+	a, ok := actions[name]
+	if !ok {
+		return res, fmt.Errorf("action %s not found", name)
+	}
+	return a.invoke(ex, params)
+}
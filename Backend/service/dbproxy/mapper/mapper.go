@@ -1,59 +1,427 @@
 package mapper
 
 import (
+	"cloud_distributed_storage/Backend/common"
+	mydb "cloud_distributed_storage/Backend/service/dbproxy/conn"
 	"cloud_distributed_storage/Backend/service/dbproxy/orm"
-	"fmt"
-	"reflect"
-)
-
-var funcs = map[string]interface{}{
-	"/file/OnFileUploadFinished":        orm.OnFileUploadFinished,
-	"/file/GetFileMeta":                 orm.GetFileMeta,
-	"/file/GetFileMetaList":             orm.GetFileMetaList,
-	"/file/UpdateFileLocation":          orm.UpdateFileLocation,
-	"/file/UpdateUserFileDownloadCount": orm.UpdateUserFileDownloadCount,
-
-	"/user/UserSignup":        orm.UserSignup,
-	"/user/UserLogin":         orm.UserLogin,
-	"/user/UserExist":         orm.UserExist,
-	"/user/UpdateToken":       orm.UpdateToken,
-	"/user/GetUserInfo":       orm.GetUserInfo,
-	"/user/UserLogout":        orm.UserLogout,
-	"/user/DeleteUserAccount": orm.DeleteUserAccount,
-
-	"/ufile/OnUserFileUploadFinished": orm.OnUserFileUploadFinished,
-	"/ufile/QueryUserFileMetas":       orm.QueryUserFileMetas,
-	"/ufile/QueryUserFileMeta":        orm.QueryUserFileMeta,
-	"/ufile/UpdateUserFileName":       orm.RenameFileName,
-	"/ufile/DeleteUserFile":           orm.DeleteUserFile,
-
-	// 新增的RBAC相关函数映射
-	"/role/CreateRole":             orm.CreateRole,
-	"/role/GetRoleInfo":            orm.GetRoleInfo,
-	"/user/AssignRole":             orm.UpdateRole,
-	"/user/RemoveRole":             orm.DeleteRole,
-	"/permission/GrantPermission":  orm.GrantPermission,
-	"/permission/RevokePermission": orm.RevokePermission,
-	"/permission/CheckPermission":  orm.CheckPermission,
-}
-
-func FunCall(name string, params ...interface{}) (result []reflect.Value, err error) {
-	f, ok := funcs[name]
-	if !ok {
-		err = fmt.Errorf("func %s not found", name)
-		return
-	}
-	// use reflect to call the function
-	fv := reflect.ValueOf(f)
-	if len(params) != fv.Type().NumIn() {
-		err = fmt.Errorf("func %s need %d params", name, fv.Type().NumIn())
-		return
-	}
-	// construct a slice of reflect.Value
-	in := make([]reflect.Value, len(params))
-	for k, param := range params {
-		in[k] = reflect.ValueOf(param)
-	}
-	result = fv.Call(in)
-	return
+	"time"
+)
+
+// FileReq : 按文件hash操作的请求参数
+type FileReq struct {
+	FileHash string `json:"filehash"`
+}
+
+// FileAddrReq : 按文件hash及存储地址操作的请求参数
+type FileAddrReq struct {
+	FileHash string `json:"filehash"`
+	FileAddr string `json:"fileaddr"`
+}
+
+// UserReq : 按用户名操作的请求参数
+type UserReq struct {
+	UserName string `json:"username"`
+}
+
+// UserFileReq : 按用户名及文件hash操作的请求参数
+type UserFileReq struct {
+	UserName string `json:"username"`
+	FileHash string `json:"filehash"`
+}
+
+// UserLimitReq : 分页查询用户记录的请求参数
+type UserLimitReq struct {
+	UserName string `json:"username"`
+	Limit    int64  `json:"limit"`
+}
+
+// RoleReq : 按角色名操作的请求参数
+type RoleReq struct {
+	RoleName string `json:"role_name"`
+}
+
+// UserRoleReq : 用户与角色关联的请求参数
+type UserRoleReq struct {
+	UserName string `json:"username"`
+	RoleName string `json:"role_name"`
+}
+
+type OnFileUploadFinishedReq struct {
+	FileHash string `json:"filehash"`
+	FileName string `json:"filename"`
+	FileSize int64  `json:"filesize"`
+	FileAddr string `json:"fileaddr"`
+}
+
+type FileMetaListReq struct {
+	AfterID int64 `json:"after_id"`
+	Limit   int64 `json:"limit"`
+}
+
+type UpdateFileStatusReq struct {
+	FileHash string            `json:"filehash"`
+	Status   common.FileStatus `json:"status"`
+}
+
+type UserSignupReq struct {
+	UserName string `json:"username"`
+	Passwd   string `json:"passwd"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+}
+
+type UserLoginReq struct {
+	UserName string `json:"username"`
+	EncPwd   string `json:"encpwd"`
+}
+
+type UpdateTokenReq struct {
+	UserName string `json:"username"`
+	Token    string `json:"token"`
+}
+
+type OnUserFileUploadFinishedReq struct {
+	UserName string `json:"username"`
+	FileHash string `json:"filehash"`
+	FileName string `json:"filename"`
+	FileSize int64  `json:"filesize"`
+}
+
+type UserFilesByStatusReq struct {
+	UserName string                `json:"username"`
+	Status   common.UserFileStatus `json:"status"`
+	Limit    int64                 `json:"limit"`
+}
+
+type RenameFileReq struct {
+	UserName string `json:"username"`
+	FileHash string `json:"filehash"`
+	FileName string `json:"filename"`
+}
+
+type ChunkReq struct {
+	ChunkHash string `json:"chunkhash"`
+}
+
+type AddChunkReq struct {
+	ChunkHash string `json:"chunkhash"`
+	ChunkSize int64  `json:"chunksize"`
+	ChunkAddr string `json:"chunkaddr"`
+}
+
+type ChunksReq struct {
+	ChunkHashes []string `json:"chunkhashes"`
 }
+
+type AddFileChunksReq struct {
+	FileHash string `json:"filehash"`
+	Manifest string `json:"manifest"`
+}
+
+type CreateTransferJobReq struct {
+	FileHash      string           `json:"filehash"`
+	UserName      string           `json:"username"`
+	SrcAddr       string           `json:"src_addr"`
+	DestAddr      string           `json:"dest_addr"`
+	DestStoreType common.StoreType `json:"dest_store_type"`
+}
+
+type UpdateTransferJobReq struct {
+	JobID     int64                 `json:"job_id"`
+	Status    common.TransferStatus `json:"status"`
+	LastError string                `json:"last_error"`
+}
+
+type AddFileReplicaReq struct {
+	FileHash  string           `json:"filehash"`
+	FileAddr  string           `json:"fileaddr"`
+	StoreType common.StoreType `json:"store_type"`
+}
+
+type ColdFilesReq struct {
+	AddrPrefix string    `json:"addr_prefix"`
+	Before     time.Time `json:"before"`
+	Limit      int64     `json:"limit"`
+}
+
+type ExpiredUserFilesReq struct {
+	Before time.Time `json:"before"`
+	Limit  int64     `json:"limit"`
+}
+
+type CreateRoleReq struct {
+	RoleName    string `json:"role_name"`
+	Description string `json:"description"`
+}
+
+type UpdateRoleReq struct {
+	RoleName    string `json:"role_name"`
+	NewRoleName string `json:"new_role_name"`
+	Description string `json:"description"`
+}
+
+type GrantPermissionReq struct {
+	RoleName   string     `json:"role_name"`
+	UserName   string     `json:"username"`
+	FileHash   string     `json:"filehash"`
+	PermRead   bool       `json:"perm_read"`
+	PermWrite  bool       `json:"perm_write"`
+	PermDelete bool       `json:"perm_delete"`
+	PermShare  bool       `json:"perm_share"`
+	ExpireTime *time.Time `json:"expire_time"`
+}
+
+type RevokePermissionReq struct {
+	RoleName string `json:"role_name"`
+	UserName string `json:"username"`
+	FileHash string `json:"filehash"`
+}
+
+// 文件表
+var (
+	OnFileUploadFinished = register[OnFileUploadFinishedReq, struct{}]("/file/OnFileUploadFinished",
+		func(ex mydb.Executor, r OnFileUploadFinishedReq) orm.ExecResult {
+			return orm.OnFileUploadFinished(ex, r.FileHash, r.FileName, r.FileSize, r.FileAddr)
+		})
+	GetFileMeta = registerRead[FileReq, orm.TableFile]("/file/GetFileMeta",
+		func(ex mydb.Executor, r FileReq) orm.ExecResult {
+			return orm.GetFileMeta(ex, r.FileHash)
+		})
+	// GetFileRecord : 不过滤文件状态, 在主库查询
+	GetFileRecord = register[FileReq, orm.TableFile]("/file/GetFileRecord",
+		func(ex mydb.Executor, r FileReq) orm.ExecResult {
+			return orm.GetFileRecord(ex, r.FileHash)
+		})
+	GetFileMetaList = registerRead[FileMetaListReq, []orm.TableFile]("/file/GetFileMetaList",
+		func(ex mydb.Executor, r FileMetaListReq) orm.ExecResult {
+			return orm.GetFileMetaList(ex, r.AfterID, r.Limit)
+		})
+	UpdateFileLocation = register[FileAddrReq, struct{}]("/file/UpdateFileLocation",
+		func(ex mydb.Executor, r FileAddrReq) orm.ExecResult {
+			return orm.UpdateFileLocation(ex, r.FileHash, r.FileAddr)
+		})
+	UpdateFileStatus = register[UpdateFileStatusReq, struct{}]("/file/UpdateFileStatus",
+		func(ex mydb.Executor, r UpdateFileStatusReq) orm.ExecResult {
+			return orm.UpdateFileStatus(ex, r.FileHash, int64(r.Status))
+		})
+	UpdateUserFileDownloadCount = register[UserFileReq, struct{}]("/file/UpdateUserFileDownloadCount",
+		func(ex mydb.Executor, r UserFileReq) orm.ExecResult {
+			return orm.UpdateUserFileDownloadCount(ex, r.UserName, r.FileHash)
+		})
+)
+
+// 用户表
+var (
+	UserSignup = register[UserSignupReq, struct{}]("/user/UserSignup",
+		func(ex mydb.Executor, r UserSignupReq) orm.ExecResult {
+			return orm.UserSignup(ex, r.UserName, r.Passwd, r.Email, r.Phone)
+		})
+	UserLogin = register[UserLoginReq, int64]("/user/UserLogin",
+		func(ex mydb.Executor, r UserLoginReq) orm.ExecResult {
+			return orm.UserLogin(ex, r.UserName, r.EncPwd)
+		})
+	UserExist = registerRead[UserReq, bool]("/user/UserExist",
+		func(ex mydb.Executor, r UserReq) orm.ExecResult {
+			return orm.UserExist(ex, r.UserName)
+		})
+	UpdateToken = register[UpdateTokenReq, struct{}]("/user/UpdateToken",
+		func(ex mydb.Executor, r UpdateTokenReq) orm.ExecResult {
+			return orm.UpdateToken(ex, r.UserName, r.Token)
+		})
+	GetUserInfo = registerRead[UserReq, orm.TableUser]("/user/GetUserInfo",
+		func(ex mydb.Executor, r UserReq) orm.ExecResult {
+			return orm.GetUserInfo(ex, r.UserName)
+		})
+	UserLogout = register[UserReq, struct{}]("/user/UserLogout",
+		func(ex mydb.Executor, r UserReq) orm.ExecResult {
+			return orm.UserLogout(ex, r.UserName)
+		})
+	DeleteUserAccount = register[UserReq, struct{}]("/user/DeleteUserAccount",
+		func(ex mydb.Executor, r UserReq) orm.ExecResult {
+			return orm.DeleteUserAccount(ex, r.UserName)
+		})
+)
+
+// 用户文件表
+var (
+	OnUserFileUploadFinished = register[OnUserFileUploadFinishedReq, struct{}]("/ufile/OnUserFileUploadFinished",
+		func(ex mydb.Executor, r OnUserFileUploadFinishedReq) orm.ExecResult {
+			return orm.OnUserFileUploadFinished(ex, r.UserName, r.FileHash, r.FileName, r.FileSize)
+		})
+	QueryUserFileMetas = registerRead[UserLimitReq, []orm.TableUserFile]("/ufile/QueryUserFileMetas",
+		func(ex mydb.Executor, r UserLimitReq) orm.ExecResult {
+			return orm.QueryUserFileMetas(ex, r.UserName, int(r.Limit))
+		})
+	QueryUserFileMeta = registerRead[UserFileReq, orm.TableUserFile]("/ufile/QueryUserFileMeta",
+		func(ex mydb.Executor, r UserFileReq) orm.ExecResult {
+			return orm.QueryUserFileMeta(ex, r.UserName, r.FileHash)
+		})
+	UpdateUserFileName = register[RenameFileReq, struct{}]("/ufile/UpdateUserFileName",
+		func(ex mydb.Executor, r RenameFileReq) orm.ExecResult {
+			return orm.RenameFileName(ex, r.UserName, r.FileHash, r.FileName)
+		})
+	DeleteUserFile = register[UserFileReq, struct{}]("/ufile/DeleteUserFile",
+		func(ex mydb.Executor, r UserFileReq) orm.ExecResult {
+			return orm.DeleteUserFile(ex, r.UserName, r.FileHash)
+		})
+	RestoreUserFile = register[UserFileReq, struct{}]("/ufile/RestoreUserFile",
+		func(ex mydb.Executor, r UserFileReq) orm.ExecResult {
+			return orm.RestoreUserFile(ex, r.UserName, r.FileHash)
+		})
+	QueryUserFilesByStatus = registerRead[UserFilesByStatusReq, []orm.TableUserFile]("/ufile/QueryUserFilesByStatus",
+		func(ex mydb.Executor, r UserFilesByStatusReq) orm.ExecResult {
+			return orm.QueryUserFilesByStatus(ex, r.UserName, int(r.Status), int(r.Limit))
+		})
+)
+
+// 文件分块清单
+var (
+	// AcquireChunk : Data为已存在分块的地址, 分块不存在时为空
+	AcquireChunk = register[ChunkReq, string]("/chunk/AcquireChunk",
+		func(ex mydb.Executor, r ChunkReq) orm.ExecResult {
+			return orm.AcquireChunk(ex, r.ChunkHash)
+		})
+	// AddChunk : Data为最终生效的分块地址
+	AddChunk = register[AddChunkReq, string]("/chunk/AddChunk",
+		func(ex mydb.Executor, r AddChunkReq) orm.ExecResult {
+			return orm.AddChunk(ex, r.ChunkHash, r.ChunkSize, r.ChunkAddr)
+		})
+	// UnrefChunks : Data为不再被引用的分块地址
+	UnrefChunks = register[ChunksReq, []string]("/chunk/UnrefChunks",
+		func(ex mydb.Executor, r ChunksReq) orm.ExecResult {
+			return orm.UnrefChunks(ex, r.ChunkHashes)
+		})
+	// AddFileChunks : 文件已有清单时Data为不再被引用的分块地址
+	AddFileChunks = register[AddFileChunksReq, []string]("/chunk/AddFileChunks",
+		func(ex mydb.Executor, r AddFileChunksReq) orm.ExecResult {
+			return orm.AddFileChunks(ex, r.FileHash, r.Manifest)
+		})
+	GetFileChunks = registerRead[FileReq, []orm.TableFileChunk]("/chunk/GetFileChunks",
+		func(ex mydb.Executor, r FileReq) orm.ExecResult {
+			return orm.GetFileChunks(ex, r.FileHash)
+		})
+	// ReleaseFileChunks : Data为不再被引用的分块地址
+	ReleaseFileChunks = register[FileReq, []string]("/chunk/ReleaseFileChunks",
+		func(ex mydb.Executor, r FileReq) orm.ExecResult {
+			return orm.ReleaseFileChunks(ex, r.FileHash)
+		})
+)
+
+// 文件转移任务
+var (
+	// CreateTransferJob : Data为任务id
+	CreateTransferJob = register[CreateTransferJobReq, int64]("/transfer/CreateTransferJob",
+		func(ex mydb.Executor, r CreateTransferJobReq) orm.ExecResult {
+			return orm.CreateTransferJob(ex, r.FileHash, r.UserName, r.SrcAddr, r.DestAddr, int64(r.DestStoreType))
+		})
+	UpdateTransferJob = register[UpdateTransferJobReq, struct{}]("/transfer/UpdateTransferJob",
+		func(ex mydb.Executor, r UpdateTransferJobReq) orm.ExecResult {
+			return orm.UpdateTransferJob(ex, r.JobID, int64(r.Status), r.LastError)
+		})
+	// GetTransferJobsByFile : 只返回username发起的任务, 不暴露其他用户存储了相同内容
+	GetTransferJobsByFile = registerRead[UserFileReq, []orm.TableTransferJob]("/transfer/GetTransferJobsByFile",
+		func(ex mydb.Executor, r UserFileReq) orm.ExecResult {
+			return orm.GetTransferJobsByFile(ex, r.UserName, r.FileHash)
+		})
+	GetTransferJobsByUser = registerRead[UserLimitReq, []orm.TableTransferJob]("/transfer/GetTransferJobsByUser",
+		func(ex mydb.Executor, r UserLimitReq) orm.ExecResult {
+			return orm.GetTransferJobsByUser(ex, r.UserName, r.Limit)
+		})
+)
+
+// 文件副本
+var (
+	AddFileReplica = register[AddFileReplicaReq, struct{}]("/replica/AddFileReplica",
+		func(ex mydb.Executor, r AddFileReplicaReq) orm.ExecResult {
+			return orm.AddFileReplica(ex, r.FileHash, r.FileAddr, int64(r.StoreType))
+		})
+	GetFileReplicas = registerRead[FileReq, []orm.TableFileReplica]("/replica/GetFileReplicas",
+		func(ex mydb.Executor, r FileReq) orm.ExecResult {
+			return orm.GetFileReplicas(ex, r.FileHash)
+		})
+	RemoveFileReplica = register[FileAddrReq, struct{}]("/replica/RemoveFileReplica",
+		func(ex mydb.Executor, r FileAddrReq) orm.ExecResult {
+			return orm.RemoveFileReplica(ex, r.FileHash, r.FileAddr)
+		})
+)
+
+// 生命周期
+var (
+	GetColdFiles = registerRead[ColdFilesReq, []orm.TableFile]("/lifecycle/GetColdFiles",
+		func(ex mydb.Executor, r ColdFilesReq) orm.ExecResult {
+			return orm.GetColdFiles(ex, r.AddrPrefix, r.Before.Unix(), r.Limit)
+		})
+	GetExpiredUserFiles = registerRead[ExpiredUserFilesReq, []orm.TableUserFile]("/lifecycle/GetExpiredUserFiles",
+		func(ex mydb.Executor, r ExpiredUserFilesReq) orm.ExecResult {
+			return orm.GetExpiredUserFiles(ex, r.Before.Unix(), r.Limit)
+		})
+	// PurgeUserFile : 文件不再被引用时Data为其file_addr
+	PurgeUserFile = register[UserFileReq, string]("/lifecycle/PurgeUserFile",
+		func(ex mydb.Executor, r UserFileReq) orm.ExecResult {
+			return orm.PurgeUserFile(ex, r.UserName, r.FileHash)
+		})
+)
+
+// RBAC
+var (
+	CreateRole = register[CreateRoleReq, struct{}]("/role/CreateRole",
+		func(ex mydb.Executor, r CreateRoleReq) orm.ExecResult {
+			return orm.CreateRole(ex, r.RoleName, r.Description)
+		})
+	GetRoleInfo = registerRead[RoleReq, orm.TableRole]("/role/GetRoleInfo",
+		func(ex mydb.Executor, r RoleReq) orm.ExecResult {
+			return orm.GetRoleInfo(ex, r.RoleName)
+		})
+	UpdateRole = register[UpdateRoleReq, struct{}]("/role/UpdateRole",
+		func(ex mydb.Executor, r UpdateRoleReq) orm.ExecResult {
+			return orm.UpdateRole(ex, r.RoleName, r.NewRoleName, r.Description)
+		})
+	DeleteRole = register[RoleReq, struct{}]("/role/DeleteRole",
+		func(ex mydb.Executor, r RoleReq) orm.ExecResult {
+			return orm.DeleteRole(ex, r.RoleName)
+		})
+	ListRoles = registerRead[struct{}, []orm.TableRole]("/role/ListRoles",
+		func(ex mydb.Executor, _ struct{}) orm.ExecResult {
+			return orm.ListRoles(ex)
+		})
+	GetUserRoles = registerRead[UserReq, []orm.TableRole]("/role/GetUserRoles",
+		func(ex mydb.Executor, r UserReq) orm.ExecResult {
+			return orm.GetUserRoles(ex, r.UserName)
+		})
+	GetRoleUsers = registerRead[RoleReq, []orm.TableUser]("/role/GetRoleUsers",
+		func(ex mydb.Executor, r RoleReq) orm.ExecResult {
+			return orm.GetRoleUsers(ex, r.RoleName)
+		})
+	AssignRole = register[UserRoleReq, struct{}]("/user/AssignRole",
+		func(ex mydb.Executor, r UserRoleReq) orm.ExecResult {
+			return orm.AssignRoleToUser(ex, r.UserName, r.RoleName)
+		})
+	RemoveRole = register[UserRoleReq, struct{}]("/user/RemoveRole",
+		func(ex mydb.Executor, r UserRoleReq) orm.ExecResult {
+			return orm.RemoveRoleFromUser(ex, r.UserName, r.RoleName)
+		})
+	GrantPermission = register[GrantPermissionReq, struct{}]("/permission/GrantPermission",
+		func(ex mydb.Executor, r GrantPermissionReq) orm.ExecResult {
+			return orm.GrantPermission(ex, r.RoleName, r.UserName, r.FileHash,
+				r.PermRead, r.PermWrite, r.PermDelete, r.PermShare, r.ExpireTime)
+		})
+	RevokePermission = register[RevokePermissionReq, struct{}]("/permission/RevokePermission",
+		func(ex mydb.Executor, r RevokePermissionReq) orm.ExecResult {
+			return orm.RevokePermission(ex, r.RoleName, r.UserName, r.FileHash)
+		})
+	// CheckPermission : Data为read/write/delete/share各项权限
+	CheckPermission = registerRead[UserFileReq, map[string]bool]("/permission/CheckPermission",
+		func(ex mydb.Executor, r UserFileReq) orm.ExecResult {
+			return orm.CheckPermission(ex, r.UserName, r.FileHash)
+		})
+	ListUserPermissions = registerRead[UserReq, []map[string]interface{}]("/permission/ListUserPermissions",
+		func(ex mydb.Executor, r UserReq) orm.ExecResult {
+			return orm.ListUserPermissions(ex, r.UserName)
+		})
+)
+
+// Routes : 列出服务端已注册的全部操作, 供客户端启动自检
+var Routes = registerRead[struct{}, []string]("/meta/Routes",
+	func(_ mydb.Executor, _ struct{}) orm.ExecResult {
+		return orm.ExecResult{Suc: true, Data: Names()}
+	})
@@ -0,0 +1,97 @@
+package mapper
+
+import (
+	"cloud_distributed_storage/Backend/service/dbproxy/orm"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFunCallErrors(t *testing.T) {
+	_, err := FunCall(nil, "/file/NotExist", []byte(`{}`))
+	assert.EqualError(t, err, "action /file/NotExist not found")
+
+	// 旧的按位置传参及未知字段均视为参数无效, 不会调用orm函数
+	_, err = FunCall(nil, GetFileMeta.Name, []byte(`["abc"]`))
+	assert.ErrorContains(t, err, "/file/GetFileMeta: invalid params")
+	_, err = FunCall(nil, GetFileMeta.Name, []byte(`{"file_hash":"abc"}`))
+	assert.ErrorContains(t, err, "invalid params")
+}
+
+func TestParamsRoundTrip(t *testing.T) {
+	expire := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	params, err := GrantPermission.Params(GrantPermissionReq{
+		UserName:   "alice",
+		FileHash:   "abc",
+		PermRead:   true,
+		PermShare:  true,
+		ExpireTime: &expire,
+	})
+	require.NoError(t, err)
+
+	var req GrantPermissionReq
+	require.NoError(t, json.Unmarshal(params, &req))
+	assert.True(t, req.PermRead)
+	assert.False(t, req.PermWrite)
+	assert.True(t, req.PermShare)
+	assert.True(t, expire.Equal(*req.ExpireTime))
+}
+
+func TestResult(t *testing.T) {
+	data, _ := json.Marshal(orm.TableFile{
+		ID:       7,
+		FileHash: "abc",
+		FileName: sql.NullString{String: "a.txt", Valid: true},
+		FileSize: sql.NullInt64{Int64: 36, Valid: true},
+	})
+	tfile, err := GetFileMeta.Result(data)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), tfile.ID)
+	assert.Equal(t, "a.txt", tfile.FileName.String)
+	assert.Equal(t, int64(36), tfile.FileSize.Int64)
+
+	jobID, err := CreateTransferJob.Result(json.RawMessage(`12345678901`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(12345678901), jobID)
+
+	_, err = CreateTransferJob.Result(json.RawMessage(`"x"`))
+	assert.ErrorContains(t, err, "/transfer/CreateTransferJob: invalid result")
+
+	_, err = OnFileUploadFinished.Result(json.RawMessage(`null`))
+	assert.NoError(t, err)
+}
+
+func TestRoutes(t *testing.T) {
+	res, err := FunCall(nil, Routes.Name, []byte(`{}`))
+	require.NoError(t, err)
+	names, err := Routes.Result(mustMarshal(t, res.Data))
+	require.NoError(t, err)
+	assert.Equal(t, Names(), names)
+
+	for _, name := range []string{
+		"/ufile/RestoreUserFile", "/ufile/QueryUserFilesByStatus", "/role/ListRoles", "/role/GetUserRoles",
+		"/role/GetRoleUsers", "/user/AssignRole", "/user/RemoveRole", "/permission/ListUserPermissions",
+	} {
+		assert.Contains(t, names, name)
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
+
+func TestReadOnly(t *testing.T) {
+	assert.True(t, ReadOnly(GetFileMeta.Name))
+	assert.True(t, ReadOnly(QueryUserFileMetas.Name))
+	assert.True(t, ReadOnly(CheckPermission.Name))
+	// 登录需读取刚写入的密码, 始终在主库执行
+	assert.False(t, ReadOnly(UserLogin.Name))
+	assert.False(t, ReadOnly(OnFileUploadFinished.Name))
+	assert.False(t, ReadOnly("/file/NotExist"))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"cloud_distributed_storage/Backend/service/dbproxy/config"
+	dbConn "cloud_distributed_storage/Backend/service/dbproxy/conn"
+	"cloud_distributed_storage/Backend/service/dbproxy/migrate"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/urfave/cli/v2"
+)
+
+// runMigrate : dbproxy migrate up|down [steps]|status [--dbhost host]
+func runMigrate(args []string) error {
+	app := &cli.App{
+		Name:  "dbproxy",
+		Usage: "database proxy service",
+		Commands: []*cli.Command{
+			{
+				Name:  "migrate",
+				Usage: "manage database schema migrations",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "dbhost", Usage: "database address"},
+				},
+				Before: func(c *cli.Context) error {
+					if dbhost := c.String("dbhost"); len(dbhost) > 0 {
+						config.UpdateDBHost(dbhost)
+					}
+					if err := migrate.EnsureDatabase(config.TiDBSource); err != nil {
+						return err
+					}
+					return dbConn.InitDBConn()
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:  "up",
+						Usage: "apply all pending migrations",
+						Action: func(c *cli.Context) error {
+							n, err := migrate.Up(c.Context, dbConn.DBConn())
+							fmt.Printf("%d migrations applied\n", n)
+							return err
+						},
+					},
+					{
+						Name:      "down",
+						Usage:     "roll back the latest applied migrations",
+						ArgsUsage: "[steps, default 1]",
+						Action: func(c *cli.Context) error {
+							steps := 1
+							if c.Args().Present() {
+								var err error
+								if steps, err = strconv.Atoi(c.Args().First()); err != nil || steps <= 0 {
+									return fmt.Errorf("invalid steps %q", c.Args().First())
+								}
+							}
+							n, err := migrate.Down(c.Context, dbConn.DBConn(), steps)
+							fmt.Printf("%d migrations rolled back\n", n)
+							return err
+						},
+					},
+					{
+						Name:  "status",
+						Usage: "show applied and pending migrations",
+						Action: func(c *cli.Context) error {
+							list, err := migrate.List(c.Context, dbConn.DBConn())
+							if err != nil {
+								return err
+							}
+							for _, s := range list {
+								state := "pending"
+								if !s.AppliedAt.IsZero() {
+									state = "applied at " + s.AppliedAt.Format("2006-01-02 15:04:05")
+								}
+								fmt.Printf("%04d  %-20s  %s\n", s.Version, s.Name, state)
+							}
+							return nil
+						},
+					},
+				},
+			},
+		},
+	}
+	return app.RunContext(context.Background(), args)
+}
+
+// autoMigrate : 服务启动时创建数据库并执行未执行的迁移
+func autoMigrate() error {
+	if !config.AutoMigrate {
+		return nil
+	}
+	n, err := migrate.Up(context.Background(), dbConn.DBConn())
+	if n > 0 {
+		log.Printf("%d migrations applied\n", n)
+	}
+	return err
+}
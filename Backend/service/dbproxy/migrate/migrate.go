@@ -0,0 +1,280 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// lockName : 多个dbproxy实例同时启动时, 通过GET_LOCK保证只有一个实例执行迁移
+const lockName = "fileserver_schema_migrate"
+
+// Migration : 一个版本的迁移, 文件名格式为<版本号>_<名称>.up.sql / .down.sql
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status : 迁移的执行状态, AppliedAt为零值表示尚未执行
+type Status struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// Migrations : 按版本号升序返回内置的全部迁移
+func Migrations() ([]Migration, error) {
+	return load(migrationFS, "migrations")
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var up bool
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			up = true
+		case strings.HasSuffix(name, ".down.sql"):
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(strings.TrimSuffix(name, ".up.sql"), ".down.sql")
+		verStr, title, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(verStr, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migrate: invalid migration file name %s", name)
+		}
+		data, err := fs.ReadFile(fsys, dir+"/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		} else if m.Name != title {
+			return nil, fmt.Errorf("migrate: version %d has different names %s and %s", version, m.Name, title)
+		}
+		if up {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrate: version %d must have both up and down files", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// EnsureDatabase : dsn中指定的数据库不存在时创建, 用于初始化全新的TiDB/MySQL
+func EnsureDatabase(dsn string) error {
+	c, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return err
+	}
+	dbName := c.DBName
+	if dbName == "" {
+		return nil
+	}
+	c.DBName = ""
+	db, err := sql.Open("mysql", c.FormatDSN())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec("CREATE DATABASE IF NOT EXISTS `" + strings.ReplaceAll(dbName, "`", "``") + "`")
+	return err
+}
+
+// Up : 按版本号顺序执行所有未执行的迁移, 返回本次执行的数量
+func Up(ctx context.Context, db *sql.DB) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if err = run(ctx, conn, m.Up); err != nil {
+				return fmt.Errorf("migrate: version %d %s up failed: %w", m.Version, m.Name, err)
+			}
+			_, err = conn.ExecContext(ctx,
+				"INSERT INTO schema_migrations (`version`, `name`, `applied_at`) VALUES (?, ?, NOW())",
+				m.Version, m.Name)
+			if err != nil {
+				return err
+			}
+			log.Printf("migrate: applied %d_%s\n", m.Version, m.Name)
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Down : 按版本号倒序回滚最近执行的steps个迁移, 返回本次回滚的数量
+func Down(ctx context.Context, db *sql.DB, steps int) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && n < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if err = run(ctx, conn, m.Down); err != nil {
+				return fmt.Errorf("migrate: version %d %s down failed: %w", m.Version, m.Name, err)
+			}
+			if _, err = conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE `version` = ?", m.Version); err != nil {
+				return err
+			}
+			log.Printf("migrate: rolled back %d_%s\n", m.Version, m.Name)
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// List : 返回全部迁移及其执行状态
+func List(ctx context.Context, db *sql.DB) ([]Status, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Status, 0, len(migrations))
+	for _, m := range migrations {
+		list = append(list, Status{Migration: m, AppliedAt: applied[m.Version]})
+	}
+	return list, nil
+}
+
+// withLock : 在同一个连接上持有迁移锁执行fn
+func withLock(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 60)", lockName).Scan(&locked); err != nil {
+		return err
+	}
+	if locked.Int64 != 1 {
+		return fmt.Errorf("migrate: failed to acquire lock %s", lockName)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+	return fn(conn)
+}
+
+// appliedVersions : 查询已执行的迁移版本, 版本表不存在时创建
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS `schema_migrations` ("+
+		"`version` bigint(20) NOT NULL, "+
+		"`name` varchar(256) NOT NULL DEFAULT '', "+
+		"`applied_at` datetime NOT NULL, "+
+		"PRIMARY KEY (`version`)"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+	if err != nil {
+		return nil, err
+	}
+	// applied_at与NOW()均按会话时区计算, 以时间戳读取避免依赖dsn中的parseTime/loc
+	rows, err := conn.QueryContext(ctx, "SELECT `version`, UNIX_TIMESTAMP(`applied_at`) FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version, appliedAt int64
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = time.Unix(appliedAt, 0)
+	}
+	return applied, rows.Err()
+}
+
+// run : 逐条执行迁移中的sql语句
+// DDL在MySQL/TiDB中会隐式提交, 无法放在事务中回滚, 因此迁移中的语句应可重复执行(如IF NOT EXISTS)
+func run(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, stmt := range statements(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statements : 按行尾的分号拆分sql语句, 忽略--开头的注释行
+func statements(script string) []string {
+	var stmts []string
+	var cur strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(cur.String()), ";"))
+			cur.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(cur.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
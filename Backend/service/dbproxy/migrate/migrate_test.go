@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_b.up.sql":   {Data: []byte("up2")},
+		"m/0002_b.down.sql": {Data: []byte("down2")},
+		"m/0001_a.up.sql":   {Data: []byte("up1")},
+		"m/0001_a.down.sql": {Data: []byte("down1")},
+		"m/README.md":       {Data: []byte("ignored")},
+	}
+	migrations, err := load(fsys, "m")
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, Migration{Version: 1, Name: "a", Up: "up1", Down: "down1"}, migrations[0])
+	assert.Equal(t, int64(2), migrations[1].Version)
+
+	delete(fsys, "m/0002_b.down.sql")
+	_, err = load(fsys, "m")
+	assert.ErrorContains(t, err, "version 2 must have both up and down files")
+
+	fsys["m/x_c.up.sql"] = &fstest.MapFile{}
+	_, err = load(fsys, "m")
+	assert.ErrorContains(t, err, "invalid migration file name x_c.up.sql")
+}
+
+func TestStatements(t *testing.T) {
+	script := "-- comment\n\nCREATE TABLE a (\n  id int\n);\nINSERT INTO a VALUES\n  (1),\n  (2);\nDROP TABLE b"
+	assert.Equal(t, []string{
+		"CREATE TABLE a (\n  id int\n)",
+		"INSERT INTO a VALUES\n  (1),\n  (2)",
+		"DROP TABLE b",
+	}, statements(script))
+}
+
+// TestSchemaCoversORM : orm中用到的每张表都应由迁移创建
+func TestSchemaCoversORM(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	var schema strings.Builder
+	for _, m := range migrations {
+		schema.WriteString(m.Up)
+	}
+
+	files, err := filepath.Glob("../orm/*.go")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	tableRe := regexp.MustCompile(`\btbl_[a-z_]+\b`)
+	for _, f := range files {
+		src, err := os.ReadFile(f)
+		require.NoError(t, err)
+		for _, table := range tableRe.FindAllString(string(src), -1) {
+			assert.Contains(t, schema.String(), "CREATE TABLE IF NOT EXISTS `"+table+"`", "%s used in %s", table, f)
+		}
+	}
+}
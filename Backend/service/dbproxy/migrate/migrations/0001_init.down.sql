@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS `tbl_permission`;
+DROP TABLE IF EXISTS `tbl_user_role`;
+DROP TABLE IF EXISTS `tbl_role`;
+DROP TABLE IF EXISTS `tbl_user_file`;
+DROP TABLE IF EXISTS `tbl_user_token`;
+DROP TABLE IF EXISTS `tbl_user`;
+DROP TABLE IF EXISTS `tbl_file`;
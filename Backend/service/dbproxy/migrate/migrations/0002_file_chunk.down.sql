@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `tbl_file_chunk`;
+DROP TABLE IF EXISTS `tbl_chunk`;
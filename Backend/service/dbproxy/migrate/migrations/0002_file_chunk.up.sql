@@ -0,0 +1,24 @@
+-- 分块去重: 分块及其引用计数, 文件的分块清单
+
+CREATE TABLE IF NOT EXISTS `tbl_chunk` (
+    `id` int(11) NOT NULL AUTO_INCREMENT,
+    `chunk_sha1` char(40) NOT NULL COMMENT '分块hash',
+    `chunk_size` bigint(20) NOT NULL DEFAULT '0' COMMENT '分块大小',
+    `chunk_addr` varchar(1024) NOT NULL DEFAULT '' COMMENT '分块存储位置',
+    `ref_count` int(11) NOT NULL DEFAULT '0' COMMENT '引用计数',
+    `create_at` datetime DEFAULT CURRENT_TIMESTAMP,
+    `update_at` datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `idx_chunk_hash` (`chunk_sha1`),
+    KEY `idx_ref_count` (`ref_count`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `tbl_file_chunk` (
+    `id` int(11) NOT NULL AUTO_INCREMENT,
+    `file_sha1` char(40) NOT NULL COMMENT '文件hash',
+    `chunk_idx` int(11) NOT NULL COMMENT '分块序号',
+    `chunk_sha1` char(40) NOT NULL COMMENT '分块hash',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `idx_file_chunk` (`file_sha1`, `chunk_idx`),
+    KEY `idx_chunk_sha1` (`chunk_sha1`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,19 @@
+-- 文件转移任务
+
+CREATE TABLE IF NOT EXISTS `tbl_transfer_job` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `file_sha1` char(40) NOT NULL COMMENT '文件hash',
+    `user_name` varchar(64) NOT NULL DEFAULT '' COMMENT '发起上传的用户',
+    `src_addr` varchar(1024) NOT NULL DEFAULT '' COMMENT '转移前的存储位置',
+    `dest_addr` varchar(1024) NOT NULL DEFAULT '' COMMENT '目标存储位置',
+    `dest_store` int(11) NOT NULL DEFAULT '0' COMMENT '目标存储类型',
+    `status` int(11) NOT NULL DEFAULT '0' COMMENT '状态(0排队中/1转移中/2成功/3失败)',
+    `attempts` int(11) NOT NULL DEFAULT '0' COMMENT '已尝试次数',
+    `last_error` varchar(1024) NOT NULL DEFAULT '' COMMENT '最近一次失败原因',
+    `create_at` datetime DEFAULT CURRENT_TIMESTAMP,
+    `update_at` datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    KEY `idx_file_sha1` (`file_sha1`),
+    KEY `idx_user_name` (`user_name`),
+    KEY `idx_status` (`status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
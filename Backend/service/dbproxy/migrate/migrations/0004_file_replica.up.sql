@@ -0,0 +1,13 @@
+-- 文件在多个存储中的副本
+
+CREATE TABLE IF NOT EXISTS `tbl_file_replica` (
+    `id` bigint(20) NOT NULL AUTO_INCREMENT,
+    `file_sha1` char(40) NOT NULL COMMENT '文件hash',
+    `store_type` int(11) NOT NULL DEFAULT '0' COMMENT '存储类型',
+    `file_addr` varchar(255) NOT NULL DEFAULT '' COMMENT '副本存储位置',
+    `status` int(11) NOT NULL DEFAULT '1' COMMENT '状态(1可用)',
+    `create_at` datetime DEFAULT CURRENT_TIMESTAMP,
+    `update_at` datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `idx_file_addr` (`file_sha1`, `file_addr`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,9 @@
+-- 主库心跳, dbproxy据此计算各只读副本的复制延迟
+
+CREATE TABLE IF NOT EXISTS `tbl_heartbeat` (
+    `id` int(11) NOT NULL COMMENT '固定为1',
+    `ts` bigint(20) NOT NULL DEFAULT '0' COMMENT '主库写入时的unix毫秒时间戳',
+    PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT IGNORE INTO `tbl_heartbeat` (`id`, `ts`) VALUES (1, 0);
@@ -0,0 +1,3 @@
+-- 无法区分迁移前的status=1与之后写入的0, 回滚时保持不变
+
+SELECT 1;
@@ -0,0 +1,3 @@
+-- 早期版本上传的用户文件以status=1写入, 统一为0(正常), 与回收站恢复及按状态查询一致
+
+UPDATE `tbl_user_file` SET `status` = 0 WHERE `status` = 1;
@@ -0,0 +1,303 @@
+package orm
+
+import (
+	mydb "cloud_distributed_storage/Backend/service/dbproxy/conn"
+	"database/sql"
+	"encoding/json"
+	"log"
+)
+
+// AcquireChunk 分块已存在时增加其引用计数, 成功时Data为分块地址, 分块不存在时Data为空
+// 与ReleaseFileChunks在同一行上加锁, 计数增加后分块不会再被释放删除
+func AcquireChunk(ex mydb.Executor, chunkHash string) (res ExecResult) {
+	tx, err := mydb.Begin(ex)
+	if err != nil {
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+
+	var chunkAddr string
+	ret, err := tx.Exec("UPDATE tbl_chunk SET ref_count = ref_count + 1 WHERE chunk_sha1 = ? AND ref_count > 0", chunkHash)
+	if err == nil {
+		var rf int64
+		if rf, err = ret.RowsAffected(); err == nil && rf > 0 {
+			err = tx.QueryRow("SELECT chunk_addr FROM tbl_chunk WHERE chunk_sha1 = ?", chunkHash).Scan(&chunkAddr)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	res.Suc = true
+	res.Data = chunkAddr
+	return
+}
+
+// AddChunk 记录新上传的分块并将引用计数置为1
+// 其他请求已先记录了同一分块时改为增加其引用计数, Data为最终生效的分块地址
+func AddChunk(ex mydb.Executor, chunkHash string, chunkSize int64, chunkAddr string) (res ExecResult) {
+	tx, err := mydb.Begin(ex)
+	if err != nil {
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO tbl_chunk (`chunk_sha1`, `chunk_size`, `chunk_addr`, `ref_count`) VALUES (?, ?, ?, 1) "+
+			"ON DUPLICATE KEY UPDATE `ref_count` = `ref_count` + 1",
+		chunkHash, chunkSize, chunkAddr)
+	if err == nil {
+		err = tx.QueryRow("SELECT chunk_addr FROM tbl_chunk WHERE chunk_sha1 = ?", chunkHash).Scan(&chunkAddr)
+	}
+	if err != nil {
+		tx.Rollback()
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	res.Suc = true
+	res.Data = chunkAddr
+	return
+}
+
+// AddFileChunks 记录文件的分块清单, 清单中各分块的引用计数已由AcquireChunk/AddChunk增加
+// manifest为json编码的[]TableFileChunk; 文件已有清单时归还这些引用, Data为引用计数归零、需要删除的分块地址
+func AddFileChunks(ex mydb.Executor, filehash string, manifest string) (res ExecResult) {
+	var chunks []TableFileChunk
+	if err := json.Unmarshal([]byte(manifest), &chunks); err != nil {
+		log.Println("Failed to decode chunk manifest, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+
+	tx, err := mydb.Begin(ex)
+	if err != nil {
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+
+	var exists int
+	var orphans []string
+	err = tx.QueryRow("SELECT COUNT(1) FROM tbl_file_chunk WHERE file_sha1 = ? FOR UPDATE", filehash).Scan(&exists)
+	if err == nil && exists > 0 {
+		log.Printf("Chunk manifest of file %s already exists", filehash)
+		chunkHashes := make([]string, 0, len(chunks))
+		for _, chunk := range chunks {
+			chunkHashes = append(chunkHashes, chunk.ChunkHash)
+		}
+		orphans, err = unrefChunks(tx, chunkHashes)
+	} else if err == nil {
+		for _, chunk := range chunks {
+			_, err = tx.Exec(
+				"INSERT INTO tbl_file_chunk (`file_sha1`, `chunk_idx`, `chunk_sha1`) VALUES (?, ?, ?)",
+				filehash, chunk.ChunkIndex, chunk.ChunkHash)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	res.Suc = true
+	res.Data = orphans
+	return
+}
+
+// UnrefChunks 归还AcquireChunk/AddChunk增加的引用计数, 用于上传失败时回滚
+// Data为引用计数归零、需要从存储中删除的分块地址
+func UnrefChunks(ex mydb.Executor, chunkHashes []string) (res ExecResult) {
+	tx, err := mydb.Begin(ex)
+	if err != nil {
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+
+	orphans, err := unrefChunks(tx, chunkHashes)
+	if err != nil {
+		tx.Rollback()
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	res.Suc = true
+	res.Data = orphans
+	return
+}
+
+// GetFileChunks 按顺序获取文件的分块清单
+func GetFileChunks(ex mydb.Executor, filehash string) (res ExecResult) {
+	stmt, err := ex.Prepare(
+		"SELECT fc.file_sha1, fc.chunk_idx, fc.chunk_sha1, c.chunk_size, c.chunk_addr " +
+			"FROM tbl_file_chunk fc INNER JOIN tbl_chunk c ON fc.chunk_sha1 = c.chunk_sha1 " +
+			"WHERE fc.file_sha1 = ? ORDER BY fc.chunk_idx")
+	if err != nil {
+		log.Println("Failed to prepare statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(filehash)
+	if err != nil {
+		log.Println("Failed to execute statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer rows.Close()
+
+	var chunks []TableFileChunk
+	for rows.Next() {
+		chunk := TableFileChunk{}
+		err := rows.Scan(&chunk.FileHash, &chunk.ChunkIndex, &chunk.ChunkHash, &chunk.ChunkSize, &chunk.ChunkAddr)
+		if err != nil {
+			log.Println("Failed to scan row, err: ", err.Error())
+			res.Suc = false
+			res.Msg = err.Error()
+			return
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	res.Suc = true
+	res.Data = chunks
+	return
+}
+
+// ReleaseFileChunks 删除文件的分块清单并减少分块引用计数
+// 返回引用计数归零、需要从存储中删除的分块地址
+func ReleaseFileChunks(ex mydb.Executor, filehash string) (res ExecResult) {
+	tx, err := mydb.Begin(ex)
+	if err != nil {
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+
+	rows, err := tx.Query("SELECT chunk_sha1 FROM tbl_file_chunk WHERE file_sha1 = ? FOR UPDATE", filehash)
+	if err != nil {
+		tx.Rollback()
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	var chunkHashes []string
+	for rows.Next() {
+		var chunkHash string
+		if err := rows.Scan(&chunkHash); err != nil {
+			rows.Close()
+			tx.Rollback()
+			log.Println(err.Error())
+			res.Suc = false
+			res.Msg = err.Error()
+			return
+		}
+		chunkHashes = append(chunkHashes, chunkHash)
+	}
+	rows.Close()
+
+	orphans, err := unrefChunks(tx, chunkHashes)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM tbl_file_chunk WHERE file_sha1 = ?", filehash)
+	}
+	if err != nil {
+		tx.Rollback()
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Println(err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	res.Suc = true
+	res.Data = orphans
+	return
+}
+
+// unrefChunks 逐个减少分块的引用计数, 同一分块出现多次时计数多次
+// 计数归零的分块在同一事务中删除记录, 返回其地址; 之后AcquireChunk将无法再引用这些分块
+func unrefChunks(tx mydb.Tx, chunkHashes []string) ([]string, error) {
+	released := map[string]bool{}
+	for _, chunkHash := range chunkHashes {
+		if _, err := tx.Exec("UPDATE tbl_chunk SET ref_count = ref_count - 1 WHERE chunk_sha1 = ?", chunkHash); err != nil {
+			return nil, err
+		}
+		released[chunkHash] = true
+	}
+
+	var orphans []string
+	for chunkHash := range released {
+		var refCount int
+		var chunkAddr string
+		err := tx.QueryRow("SELECT ref_count, chunk_addr FROM tbl_chunk WHERE chunk_sha1 = ?", chunkHash).
+			Scan(&refCount, &chunkAddr)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if refCount <= 0 {
+			if _, err = tx.Exec("DELETE FROM tbl_chunk WHERE chunk_sha1 = ?", chunkHash); err != nil {
+				return nil, err
+			}
+			orphans = append(orphans, chunkAddr)
+		}
+	}
+	return orphans, nil
+}
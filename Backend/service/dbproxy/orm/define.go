@@ -6,6 +6,7 @@ import (
 
 // TableFile 文件表结构
 type TableFile struct {
+	ID       int64
 	FileHash string
 	FileName sql.NullString
 	FileSize sql.NullInt64
@@ -68,6 +69,39 @@ type TableUserFile struct {
 	DowndloadCount int
 }
 
+// TableFileChunk 文件分块清单表结构
+type TableFileChunk struct {
+	FileHash   string
+	ChunkIndex int
+	ChunkHash  string
+	ChunkSize  int64
+	ChunkAddr  string
+}
+
+// TableTransferJob 文件转移任务表结构
+type TableTransferJob struct {
+	ID            int64
+	FileHash      string
+	UserName      string
+	SrcAddr       string
+	DestAddr      string
+	DestStoreType int
+	Status        int
+	Attempts      int
+	LastError     string
+	CreateAt      string
+	UpdateAt      string
+}
+
+// TableFileReplica 文件副本表结构
+type TableFileReplica struct {
+	FileHash  string
+	StoreType int
+	FileAddr  string
+	Status    int
+	CreateAt  string
+}
+
 // ExecResult 执行结果
 type ExecResult struct {
 	Suc  bool        `json:"suc"`
@@ -75,3 +109,6 @@ type ExecResult struct {
 	Msg  string      `json:"msg"`
 	Data interface{} `json:"data"`
 }
+
+// CodeNotFound 查询的记录不存在, 调用方据此区分记录不存在与查询出错, 不依赖Msg的文字
+const CodeNotFound = 1
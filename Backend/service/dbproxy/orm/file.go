@@ -7,10 +7,10 @@ import (
 	"time"
 )
 
-func OnFileUploadFinished(filehash string, filename string, filesize int64, fileaddr string, ownerID int64) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(
-		"INSERT INTO tbl_file (`file_sha1`, `file_name`, `file_size`, `file_addr`, `owner_id`, `status`, `create_at`) " +
-			"VALUES (?, ?, ?, ?, ?, 1, ?) ON DUPLICATE KEY UPDATE `owner_id`=?, `update_at`=?")
+func OnFileUploadFinished(ex mydb.Executor, filehash string, filename string, filesize int64, fileaddr string) (res ExecResult) {
+	stmt, err := ex.Prepare(
+		"INSERT INTO tbl_file (`file_sha1`, `file_name`, `file_size`, `file_addr`, `status`, `create_at`) " +
+			"VALUES (?, ?, ?, ?, 1, ?) ON DUPLICATE KEY UPDATE `update_at`=?")
 	if err != nil {
 		log.Println("Failed to prepare statement, err: ", err.Error())
 		res.Suc = false
@@ -20,7 +20,7 @@ func OnFileUploadFinished(filehash string, filename string, filesize int64, file
 	defer stmt.Close()
 
 	nowTime := time.Now()
-	ret, err := stmt.Exec(filehash, filename, filesize, fileaddr, ownerID, nowTime, ownerID, nowTime)
+	ret, err := stmt.Exec(filehash, filename, filesize, fileaddr, nowTime, nowTime)
 	if err != nil {
 		log.Println("Failed to execute statement, err: ", err.Error())
 		res.Suc = false
@@ -41,10 +41,21 @@ func OnFileUploadFinished(filehash string, filename string, filesize int64, file
 	return
 }
 
-func GetFileMeta(filehash string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(
-		"SELECT id, file_sha1, file_name, file_size, file_addr, owner_id, create_at, update_at, status " +
+func GetFileMeta(ex mydb.Executor, filehash string) (res ExecResult) {
+	return getFileMeta(ex, filehash,
+		"SELECT id, file_sha1, file_name, file_size, file_addr, status "+
 			"FROM tbl_file WHERE file_sha1 = ? AND status = 1 LIMIT 1")
+}
+
+// GetFileRecord 查询文件记录, 不论文件状态(禁用/损坏/丢失的文件也会返回)
+func GetFileRecord(ex mydb.Executor, filehash string) (res ExecResult) {
+	return getFileMeta(ex, filehash,
+		"SELECT id, file_sha1, file_name, file_size, file_addr, status "+
+			"FROM tbl_file WHERE file_sha1 = ? LIMIT 1")
+}
+
+func getFileMeta(ex mydb.Executor, filehash string, query string) (res ExecResult) {
+	stmt, err := ex.Prepare(query)
 	if err != nil {
 		log.Println("Failed to prepare statement, err: ", err.Error())
 		res.Suc = false
@@ -55,11 +66,12 @@ func GetFileMeta(filehash string) (res ExecResult) {
 
 	tfile := TableFile{}
 	err = stmt.QueryRow(filehash).Scan(
-		&tfile.FileHash, &tfile.FileName, &tfile.FileSize,
+		&tfile.ID, &tfile.FileHash, &tfile.FileName, &tfile.FileSize,
 		&tfile.FileAddr, &tfile.Status)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			res.Suc = false
+			res.Code = CodeNotFound
 			res.Msg = "File not found"
 		} else {
 			log.Println("Failed to execute statement, err: ", err.Error())
@@ -74,10 +86,11 @@ func GetFileMeta(filehash string) (res ExecResult) {
 	return
 }
 
-func GetFileMetaList(limit int) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(
-		"SELECT id, file_sha1, file_name, file_size, file_addr, owner_id, create_at, update_at, status " +
-			"FROM tbl_file WHERE status = 1 LIMIT ?")
+// GetFileMetaList 按id升序分批查询可用文件, afterID为上一批最后一条记录的id
+func GetFileMetaList(ex mydb.Executor, afterID int64, limit int64) (res ExecResult) {
+	stmt, err := ex.Prepare(
+		"SELECT id, file_sha1, file_name, file_size, file_addr, status " +
+			"FROM tbl_file WHERE status = 1 AND id > ? ORDER BY id LIMIT ?")
 	if err != nil {
 		log.Println("Failed to prepare statement, err: ", err.Error())
 		res.Suc = false
@@ -86,7 +99,7 @@ func GetFileMetaList(limit int) (res ExecResult) {
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(limit)
+	rows, err := stmt.Query(afterID, limit)
 	if err != nil {
 		log.Println("Failed to execute statement, err: ", err.Error())
 		res.Suc = false
@@ -99,7 +112,7 @@ func GetFileMetaList(limit int) (res ExecResult) {
 	for rows.Next() {
 		tfile := TableFile{}
 		err := rows.Scan(
-			&tfile.FileHash, &tfile.FileName, &tfile.FileSize,
+			&tfile.ID, &tfile.FileHash, &tfile.FileName, &tfile.FileSize,
 			&tfile.FileAddr, &tfile.Status)
 		if err != nil {
 			log.Println("Failed to scan row, err: ", err.Error())
@@ -113,8 +126,30 @@ func GetFileMetaList(limit int) (res ExecResult) {
 	return
 }
 
-func UpdateFileLocation(filehash string, fileaddr string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(
+// UpdateFileStatus 更新文件状态, 如巡检发现损坏或丢失
+func UpdateFileStatus(ex mydb.Executor, filehash string, status int64) (res ExecResult) {
+	stmt, err := ex.Prepare(
+		"UPDATE tbl_file SET status = ?, update_at = ? WHERE file_sha1 = ?")
+	if err != nil {
+		log.Println("Failed to prepare statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer stmt.Close()
+
+	if _, err = stmt.Exec(status, time.Now(), filehash); err != nil {
+		log.Println("Failed to execute statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	res.Suc = true
+	return
+}
+
+func UpdateFileLocation(ex mydb.Executor, filehash string, fileaddr string) (res ExecResult) {
+	stmt, err := ex.Prepare(
 		"UPDATE tbl_file SET file_addr = ?, update_at = ? WHERE file_sha1 = ? AND status = 1")
 	if err != nil {
 		log.Println("Failed to prepare statement, err: ", err.Error())
@@ -147,8 +182,8 @@ func UpdateFileLocation(filehash string, fileaddr string) (res ExecResult) {
 	return
 }
 
-func UpdateUserFileDownloadCount(username, filehash string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(
+func UpdateUserFileDownloadCount(ex mydb.Executor, username, filehash string) (res ExecResult) {
+	stmt, err := ex.Prepare(
 		"UPDATE tbl_user_file SET download_count = download_count + 1 " +
 			"WHERE user_name = ? AND file_sha1 = ?")
 	if err != nil {
@@ -0,0 +1,145 @@
+package orm
+
+import (
+	"cloud_distributed_storage/Backend/common"
+	mydb "cloud_distributed_storage/Backend/service/dbproxy/conn"
+	"database/sql"
+	"log"
+)
+
+// GetColdFiles 查询file_addr以addrPrefix开头, 且所有用户在before(unix时间)之后都未下载或修改过的文件
+// 只统计正常状态的用户文件, 仅被回收站引用的文件留给清除任务; 已有排队中或转移中任务的文件不再返回
+func GetColdFiles(ex mydb.Executor, addrPrefix string, before int64, limit int64) (res ExecResult) {
+	stmt, err := ex.Prepare(
+		"SELECT f.file_sha1, f.file_name, f.file_size, f.file_addr, f.status FROM tbl_file f " +
+			"INNER JOIN tbl_user_file uf ON uf.file_sha1 = f.file_sha1 AND uf.status = ? " +
+			"WHERE f.status = 1 AND f.file_addr LIKE CONCAT(?, '%') " +
+			"AND NOT EXISTS (SELECT 1 FROM tbl_transfer_job j WHERE j.file_sha1 = f.file_sha1 AND j.status IN (?, ?)) " +
+			"GROUP BY f.file_sha1, f.file_name, f.file_size, f.file_addr, f.status " +
+			"HAVING MAX(uf.last_update) < FROM_UNIXTIME(?) LIMIT ?")
+	if err != nil {
+		log.Println("Failed to prepare statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(common.UserFileNormal, addrPrefix, common.TransferQueued, common.TransferRunning, before, limit)
+	if err != nil {
+		log.Println("Failed to execute statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer rows.Close()
+
+	files := []TableFile{}
+	for rows.Next() {
+		tfile := TableFile{}
+		err := rows.Scan(&tfile.FileHash, &tfile.FileName, &tfile.FileSize, &tfile.FileAddr, &tfile.Status)
+		if err != nil {
+			log.Println("Failed to scan row, err: ", err.Error())
+			res.Suc = false
+			res.Msg = err.Error()
+			return
+		}
+		files = append(files, tfile)
+	}
+
+	res.Suc = true
+	res.Data = files
+	return
+}
+
+// GetExpiredUserFiles 查询在before(unix时间)之前被用户删除的文件记录
+func GetExpiredUserFiles(ex mydb.Executor, before int64, limit int64) (res ExecResult) {
+	stmt, err := ex.Prepare(
+		"SELECT user_name, file_sha1, file_name, file_size FROM tbl_user_file " +
+			"WHERE status = 2 AND last_update < FROM_UNIXTIME(?) LIMIT ?")
+	if err != nil {
+		log.Println("Failed to prepare statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(before, limit)
+	if err != nil {
+		log.Println("Failed to execute statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer rows.Close()
+
+	userFiles := []TableUserFile{}
+	for rows.Next() {
+		ufile := TableUserFile{}
+		err := rows.Scan(&ufile.UserName, &ufile.FileHash, &ufile.FileName, &ufile.FileSize)
+		if err != nil {
+			log.Println("Failed to scan row, err: ", err.Error())
+			res.Suc = false
+			res.Msg = err.Error()
+			return
+		}
+		userFiles = append(userFiles, ufile)
+	}
+
+	res.Suc = true
+	res.Data = userFiles
+	return
+}
+
+// PurgeUserFile 彻底删除用户已删除的文件记录
+// 文件不再被任何用户引用时同时删除文件表记录, 并通过Data返回其file_addr供调用方删除存储中的对象
+func PurgeUserFile(ex mydb.Executor, username, filehash string) (res ExecResult) {
+	tx, err := mydb.Begin(ex)
+	if err != nil {
+		log.Println("Failed to begin transaction, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer tx.Rollback()
+
+	ret, err := tx.Exec("DELETE FROM tbl_user_file WHERE user_name = ? AND file_sha1 = ? AND status = 2", username, filehash)
+	if err != nil {
+		log.Println("Failed to execute statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	if rf, err := ret.RowsAffected(); err == nil && rf <= 0 {
+		res.Suc = false
+		res.Msg = "User file not found or not deleted"
+		return
+	}
+
+	var refs int64
+	var fileAddr sql.NullString
+	err = tx.QueryRow("SELECT COUNT(*) FROM tbl_user_file WHERE file_sha1 = ?", filehash).Scan(&refs)
+	if err == nil && refs == 0 {
+		err = tx.QueryRow("SELECT file_addr FROM tbl_file WHERE file_sha1 = ? FOR UPDATE", filehash).Scan(&fileAddr)
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+		if err == nil && fileAddr.Valid {
+			_, err = tx.Exec("DELETE FROM tbl_file WHERE file_sha1 = ?", filehash)
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Failed to purge user file, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+
+	res.Suc = true
+	res.Data = fileAddr.String
+	return
+}
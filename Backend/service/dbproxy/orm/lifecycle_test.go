@@ -0,0 +1,97 @@
+package orm
+
+import (
+	"cloud_distributed_storage/Backend/common"
+	"cloud_distributed_storage/Backend/service/dbproxy/migrate"
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDB : 连接DBPROXY_TEST_DSN指定的测试库并执行迁移, 未设置时跳过
+func testDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("DBPROXY_TEST_DSN")
+	if dsn == "" {
+		t.Skip("DBPROXY_TEST_DSN not set")
+	}
+	require.NoError(t, migrate.EnsureDatabase(dsn))
+	db, err := sql.Open("mysql", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	_, err = migrate.Up(context.Background(), db)
+	require.NoError(t, err)
+	return db
+}
+
+// TestReuploadSurvivesPurge : 回收站中的文件重新上传后, 清除任务不应删除该文件
+func TestReuploadSurvivesPurge(t *testing.T) {
+	db := testDB(t)
+	const user, hash = "lifecycle_test", "0123456789abcdef0123456789abcdef01234567"
+	cleanup := func() {
+		db.Exec("DELETE FROM tbl_user_file WHERE file_sha1 = ?", hash)
+		db.Exec("DELETE FROM tbl_file WHERE file_sha1 = ?", hash)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	require.True(t, OnFileUploadFinished(db, hash, "a.txt", 36, "/data/tmp/"+hash).Suc)
+	require.True(t, OnUserFileUploadFinished(db, user, hash, "a.txt", 36).Suc)
+
+	// 软删除并使其超过保留期
+	require.True(t, DeleteUserFile(db, user, hash).Suc)
+	_, err := db.Exec("UPDATE tbl_user_file SET last_update = ? WHERE file_sha1 = ?", time.Now().Add(-48*time.Hour), hash)
+	require.NoError(t, err)
+
+	// 重新上传
+	require.True(t, OnUserFileUploadFinished(db, user, hash, "b.txt", 36).Suc)
+	res := QueryUserFilesByStatus(db, user, int(common.UserFileNormal), 10)
+	require.True(t, res.Suc)
+	files := res.Data.([]TableUserFile)
+	require.Len(t, files, 1)
+	assert.Equal(t, "b.txt", files[0].FileName)
+
+	// 清除任务不再返回及删除该文件
+	res = GetExpiredUserFiles(db, time.Now().Add(-24*time.Hour).Unix(), 100)
+	require.True(t, res.Suc)
+	for _, uf := range res.Data.([]TableUserFile) {
+		assert.NotEqual(t, hash, uf.FileHash)
+	}
+	assert.False(t, PurgeUserFile(db, user, hash).Suc)
+	assert.True(t, GetFileMeta(db, hash).Suc)
+}
+
+// TestColdFilesIgnoreDeleted : 只被回收站中的用户文件引用的文件不作为冷文件迁移
+func TestColdFilesIgnoreDeleted(t *testing.T) {
+	db := testDB(t)
+	const user, hash = "lifecycle_test", "89abcdef0123456789abcdef0123456789abcdef"
+	addr := "/data/cold_test/" + hash
+	cleanup := func() {
+		db.Exec("DELETE FROM tbl_user_file WHERE file_sha1 = ?", hash)
+		db.Exec("DELETE FROM tbl_file WHERE file_sha1 = ?", hash)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+
+	require.True(t, OnFileUploadFinished(db, hash, "c.txt", 36, addr).Suc)
+	require.True(t, OnUserFileUploadFinished(db, user, hash, "c.txt", 36).Suc)
+	_, err := db.Exec("UPDATE tbl_user_file SET last_update = ? WHERE file_sha1 = ?", time.Now().Add(-48*time.Hour), hash)
+	require.NoError(t, err)
+
+	cold := func() []TableFile {
+		res := GetColdFiles(db, "/data/cold_test/", time.Now().Add(-24*time.Hour).Unix(), 10)
+		require.True(t, res.Suc)
+		return res.Data.([]TableFile)
+	}
+	assert.Len(t, cold(), 1)
+
+	require.True(t, DeleteUserFile(db, user, hash).Suc)
+	_, err = db.Exec("UPDATE tbl_user_file SET last_update = ? WHERE file_sha1 = ?", time.Now().Add(-48*time.Hour), hash)
+	require.NoError(t, err)
+	assert.Empty(t, cold())
+}
@@ -8,8 +8,8 @@ import (
 )
 
 // GrantPermission 授予权限
-func GrantPermission(roleName, userName, fileSha1 string, permRead, permWrite, permDelete, permShare bool, expireTime *time.Time) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(`
+func GrantPermission(ex mydb.Executor, roleName, userName, fileSha1 string, permRead, permWrite, permDelete, permShare bool, expireTime *time.Time) (res ExecResult) {
+	stmt, err := ex.Prepare(`
         INSERT INTO tbl_permission 
         (role_name, user_name, file_sha1, perm_read, perm_write, perm_delete, perm_share, expire_time) 
         VALUES (?, ?, ?, ?, ?, ?, ?, ?)
@@ -41,8 +41,8 @@ func GrantPermission(roleName, userName, fileSha1 string, permRead, permWrite, p
 }
 
 // RevokePermission 撤销权限
-func RevokePermission(roleName, userName, fileSha1 string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare("DELETE FROM tbl_permission WHERE role_name = ? AND user_name = ? AND file_sha1 = ?")
+func RevokePermission(ex mydb.Executor, roleName, userName, fileSha1 string) (res ExecResult) {
+	stmt, err := ex.Prepare("DELETE FROM tbl_permission WHERE role_name = ? AND user_name = ? AND file_sha1 = ?")
 	if err != nil {
 		log.Println("Failed to prepare statement, err:", err.Error())
 		res.Suc = false
@@ -64,7 +64,7 @@ func RevokePermission(roleName, userName, fileSha1 string) (res ExecResult) {
 }
 
 // CheckPermission 检查权限
-func CheckPermission(userName, fileSha1 string) (res ExecResult) {
+func CheckPermission(ex mydb.Executor, userName, fileSha1 string) (res ExecResult) {
 	query := `
         SELECT p.perm_read, p.perm_write, p.perm_delete, p.perm_share, p.expire_time
         FROM tbl_permission p
@@ -73,7 +73,7 @@ func CheckPermission(userName, fileSha1 string) (res ExecResult) {
         AND (p.expire_time IS NULL OR p.expire_time > NOW())
     `
 
-	stmt, err := mydb.DBConn().Prepare(query)
+	stmt, err := ex.Prepare(query)
 	if err != nil {
 		log.Println("Failed to prepare statement, err:", err.Error())
 		res.Suc = false
@@ -114,7 +114,7 @@ func CheckPermission(userName, fileSha1 string) (res ExecResult) {
 }
 
 // ListUserPermissions 列出用户的所有权限
-func ListUserPermissions(userName string) (res ExecResult) {
+func ListUserPermissions(ex mydb.Executor, userName string) (res ExecResult) {
 	query := `
         SELECT p.file_sha1, f.file_name, p.perm_read, p.perm_write, p.perm_delete, p.perm_share, p.expire_time
         FROM tbl_permission p
@@ -124,7 +124,7 @@ func ListUserPermissions(userName string) (res ExecResult) {
         AND (p.expire_time IS NULL OR p.expire_time > NOW())
     `
 
-	stmt, err := mydb.DBConn().Prepare(query)
+	stmt, err := ex.Prepare(query)
 	if err != nil {
 		log.Println("Failed to prepare statement, err:", err.Error())
 		res.Suc = false
@@ -0,0 +1,94 @@
+package orm
+
+import (
+	mydb "cloud_distributed_storage/Backend/service/dbproxy/conn"
+	"database/sql"
+	"log"
+)
+
+// AddFileReplica 记录文件在其他存储中的副本, 已存在时重新标记为可用
+func AddFileReplica(ex mydb.Executor, filehash, fileaddr string, storeType int64) (res ExecResult) {
+	stmt, err := ex.Prepare(
+		"INSERT INTO tbl_file_replica (`file_sha1`, `store_type`, `file_addr`, `status`) VALUES (?, ?, ?, 1) " +
+			"ON DUPLICATE KEY UPDATE `store_type` = VALUES(`store_type`), `status` = 1")
+	if err != nil {
+		log.Println("Failed to prepare statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer stmt.Close()
+
+	if _, err = stmt.Exec(filehash, storeType, fileaddr); err != nil {
+		log.Println("Failed to execute statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	res.Suc = true
+	return
+}
+
+// GetFileReplicas 查询文件的可用副本, 按写入顺序排列
+func GetFileReplicas(ex mydb.Executor, filehash string) (res ExecResult) {
+	stmt, err := ex.Prepare(
+		"SELECT file_sha1, store_type, file_addr, status, create_at FROM tbl_file_replica " +
+			"WHERE file_sha1 = ? AND status = 1 ORDER BY id")
+	if err != nil {
+		log.Println("Failed to prepare statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(filehash)
+	if err != nil {
+		log.Println("Failed to execute statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer rows.Close()
+
+	replicas := []TableFileReplica{}
+	for rows.Next() {
+		replica := TableFileReplica{}
+		var createAt sql.NullString
+		err := rows.Scan(&replica.FileHash, &replica.StoreType, &replica.FileAddr, &replica.Status, &createAt)
+		if err != nil {
+			log.Println("Failed to scan row, err: ", err.Error())
+			res.Suc = false
+			res.Msg = err.Error()
+			return
+		}
+		replica.CreateAt = createAt.String
+		replicas = append(replicas, replica)
+	}
+
+	res.Suc = true
+	res.Data = replicas
+	return
+}
+
+// RemoveFileReplica 删除文件的一个副本记录
+func RemoveFileReplica(ex mydb.Executor, filehash, fileaddr string) (res ExecResult) {
+	stmt, err := ex.Prepare(
+		"DELETE FROM tbl_file_replica WHERE file_sha1 = ? AND file_addr = ?")
+	if err != nil {
+		log.Println("Failed to prepare statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer stmt.Close()
+
+	if _, err = stmt.Exec(filehash, fileaddr); err != nil {
+		log.Println("Failed to execute statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	res.Suc = true
+	return
+}
@@ -8,8 +8,8 @@ import (
 )
 
 // CreateRole 创建新角色
-func CreateRole(roleName string, description string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(
+func CreateRole(ex mydb.Executor, roleName string, description string) (res ExecResult) {
+	stmt, err := ex.Prepare(
 		"INSERT INTO tbl_role (role_name, description, create_at) VALUES (?, ?, ?)")
 	if err != nil {
 		log.Println("Failed to prepare statement, err:", err.Error())
@@ -32,8 +32,8 @@ func CreateRole(roleName string, description string) (res ExecResult) {
 }
 
 // GetRoleInfo 获取角色信息
-func GetRoleInfo(roleName string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(
+func GetRoleInfo(ex mydb.Executor, roleName string) (res ExecResult) {
+	stmt, err := ex.Prepare(
 		"SELECT role_name, description, create_at, update_at FROM tbl_role WHERE role_name = ?")
 	if err != nil {
 		log.Println("Failed to prepare statement, err:", err.Error())
@@ -63,8 +63,8 @@ func GetRoleInfo(roleName string) (res ExecResult) {
 }
 
 // UpdateRole 更新角色信息
-func UpdateRole(roleName, newRoleName, description string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(
+func UpdateRole(ex mydb.Executor, roleName, newRoleName, description string) (res ExecResult) {
+	stmt, err := ex.Prepare(
 		"UPDATE tbl_role SET role_name = ?, description = ?, update_at = ? WHERE role_name = ?")
 	if err != nil {
 		log.Println("Failed to prepare statement, err:", err.Error())
@@ -87,8 +87,8 @@ func UpdateRole(roleName, newRoleName, description string) (res ExecResult) {
 }
 
 // DeleteRole 删除角色
-func DeleteRole(roleName string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare("DELETE FROM tbl_role WHERE role_name = ?")
+func DeleteRole(ex mydb.Executor, roleName string) (res ExecResult) {
+	stmt, err := ex.Prepare("DELETE FROM tbl_role WHERE role_name = ?")
 	if err != nil {
 		log.Println("Failed to prepare statement, err:", err.Error())
 		res.Suc = false
@@ -110,8 +110,8 @@ func DeleteRole(roleName string) (res ExecResult) {
 }
 
 // ListRoles 列出所有角色
-func ListRoles() (res ExecResult) {
-	rows, err := mydb.DBConn().Query("SELECT role_name, description, create_at, update_at FROM tbl_role")
+func ListRoles(ex mydb.Executor) (res ExecResult) {
+	rows, err := ex.Query("SELECT role_name, description, create_at, update_at FROM tbl_role")
 	if err != nil {
 		log.Println("Failed to execute query, err:", err.Error())
 		res.Suc = false
@@ -137,8 +137,8 @@ func ListRoles() (res ExecResult) {
 }
 
 // AssignRoleToUser 为用户分配角色
-func AssignRoleToUser(userName, roleName string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(
+func AssignRoleToUser(ex mydb.Executor, userName, roleName string) (res ExecResult) {
+	stmt, err := ex.Prepare(
 		"INSERT INTO tbl_user_role (user_name, role_name, create_at) VALUES (?, ?, ?)")
 	if err != nil {
 		log.Println("Failed to prepare statement, err:", err.Error())
@@ -161,8 +161,8 @@ func AssignRoleToUser(userName, roleName string) (res ExecResult) {
 }
 
 // RemoveRoleFromUser 从用户移除角色
-func RemoveRoleFromUser(userName, roleName string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare("DELETE FROM tbl_user_role WHERE user_name = ? AND role_name = ?")
+func RemoveRoleFromUser(ex mydb.Executor, userName, roleName string) (res ExecResult) {
+	stmt, err := ex.Prepare("DELETE FROM tbl_user_role WHERE user_name = ? AND role_name = ?")
 	if err != nil {
 		log.Println("Failed to prepare statement, err:", err.Error())
 		res.Suc = false
@@ -184,8 +184,8 @@ func RemoveRoleFromUser(userName, roleName string) (res ExecResult) {
 }
 
 // GetUserRoles 获取用户的所有角色
-func GetUserRoles(userName string) (res ExecResult) {
-	rows, err := mydb.DBConn().Query(`
+func GetUserRoles(ex mydb.Executor, userName string) (res ExecResult) {
+	rows, err := ex.Query(`
         SELECT r.role_name, r.description, r.create_at, r.update_at
         FROM tbl_role r
         INNER JOIN tbl_user_role ur ON r.role_name = ur.role_name
@@ -216,8 +216,8 @@ func GetUserRoles(userName string) (res ExecResult) {
 }
 
 // GetRoleUsers 获取拥有特定角色的所有用户
-func GetRoleUsers(roleName string) (res ExecResult) {
-	rows, err := mydb.DBConn().Query(`
+func GetRoleUsers(ex mydb.Executor, roleName string) (res ExecResult) {
+	rows, err := ex.Query(`
         SELECT u.user_name, u.email, u.phone, u.signup_at, u.last_active, u.status
         FROM tbl_user u
         INNER JOIN tbl_user_role ur ON u.user_name = ur.user_name
@@ -0,0 +1,126 @@
+package orm
+
+import (
+	"cloud_distributed_storage/Backend/common"
+	mydb "cloud_distributed_storage/Backend/service/dbproxy/conn"
+	"database/sql"
+	"log"
+)
+
+// CreateTransferJob 新增一条排队中的文件转移任务, 返回任务id
+func CreateTransferJob(ex mydb.Executor, filehash, username, srcAddr, destAddr string, destStoreType int64) (res ExecResult) {
+	stmt, err := ex.Prepare(
+		"INSERT INTO tbl_transfer_job (`file_sha1`, `user_name`, `src_addr`, `dest_addr`, `dest_store`, `status`) " +
+			"VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		log.Println("Failed to prepare statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer stmt.Close()
+
+	ret, err := stmt.Exec(filehash, username, srcAddr, destAddr, destStoreType, common.TransferQueued)
+	if err != nil {
+		log.Println("Failed to execute statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	jobID, err := ret.LastInsertId()
+	if err != nil {
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	res.Suc = true
+	res.Data = jobID
+	return
+}
+
+// UpdateTransferJob 更新转移任务状态, 每次进入转移中状态时尝试次数加一
+func UpdateTransferJob(ex mydb.Executor, jobID int64, status int64, lastError string) (res ExecResult) {
+	stmt, err := ex.Prepare(
+		"UPDATE tbl_transfer_job SET `status` = ?, `last_error` = ?, " +
+			"`attempts` = `attempts` + IF(? = ?, 1, 0) WHERE `id` = ?")
+	if err != nil {
+		log.Println("Failed to prepare statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer stmt.Close()
+
+	if len(lastError) > 1024 {
+		lastError = lastError[:1024]
+	}
+	ret, err := stmt.Exec(status, lastError, status, common.TransferRunning, jobID)
+	if err != nil {
+		log.Println("Failed to execute statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	if rf, err := ret.RowsAffected(); err == nil && rf <= 0 {
+		log.Printf("Transfer job %d not found", jobID)
+		res.Suc = false
+		res.Msg = "Transfer job not found"
+		return
+	}
+	res.Suc = true
+	return
+}
+
+// GetTransferJobsByFile 查询用户对文件发起的转移任务, 最近的在前
+func GetTransferJobsByFile(ex mydb.Executor, username, filehash string) (res ExecResult) {
+	return queryTransferJobs(ex,
+		"SELECT id, file_sha1, user_name, src_addr, dest_addr, dest_store, status, attempts, last_error, create_at, update_at "+
+			"FROM tbl_transfer_job WHERE file_sha1 = ? AND user_name = ? ORDER BY id DESC", filehash, username)
+}
+
+// GetTransferJobsByUser 查询用户最近的转移任务
+func GetTransferJobsByUser(ex mydb.Executor, username string, limit int64) (res ExecResult) {
+	return queryTransferJobs(ex,
+		"SELECT id, file_sha1, user_name, src_addr, dest_addr, dest_store, status, attempts, last_error, create_at, update_at "+
+			"FROM tbl_transfer_job WHERE user_name = ? ORDER BY id DESC LIMIT ?", username, limit)
+}
+
+func queryTransferJobs(ex mydb.Executor, query string, args ...interface{}) (res ExecResult) {
+	stmt, err := ex.Prepare(query)
+	if err != nil {
+		log.Println("Failed to prepare statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		log.Println("Failed to execute statement, err: ", err.Error())
+		res.Suc = false
+		res.Msg = err.Error()
+		return
+	}
+	defer rows.Close()
+
+	jobs := []TableTransferJob{}
+	for rows.Next() {
+		job := TableTransferJob{}
+		var createAt, updateAt sql.NullString
+		err := rows.Scan(&job.ID, &job.FileHash, &job.UserName, &job.SrcAddr, &job.DestAddr,
+			&job.DestStoreType, &job.Status, &job.Attempts, &job.LastError, &createAt, &updateAt)
+		if err != nil {
+			log.Println("Failed to scan row, err: ", err.Error())
+			res.Suc = false
+			res.Msg = err.Error()
+			return
+		}
+		job.CreateAt, job.UpdateAt = createAt.String, updateAt.String
+		jobs = append(jobs, job)
+	}
+
+	res.Suc = true
+	res.Data = jobs
+	return
+}
@@ -7,8 +7,8 @@ import (
 	"time"
 )
 
-func UserSignup(username, passwd, email, phone string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(
+func UserSignup(ex mydb.Executor, username, passwd, email, phone string) (res ExecResult) {
+	stmt, err := ex.Prepare(
 		"INSERT INTO tbl_user (`user_name`, `user_pwd`, `email`, `phone`, `signup_at`) VALUES (?, ?, ?, ?, ?)")
 	if err != nil {
 		log.Println("Failed to prepare statement, err: ", err.Error())
@@ -36,8 +36,8 @@ func UserSignup(username, passwd, email, phone string) (res ExecResult) {
 	return
 }
 
-func UserLogin(username string, encpwd string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare("SELECT id, user_pwd FROM tbl_user WHERE user_name = ? LIMIT 1")
+func UserLogin(ex mydb.Executor, username string, encpwd string) (res ExecResult) {
+	stmt, err := ex.Prepare("SELECT id, user_pwd FROM tbl_user WHERE user_name = ? LIMIT 1")
 	if err != nil {
 		log.Println(err.Error())
 		res.Suc = false
@@ -73,8 +73,8 @@ func UserLogin(username string, encpwd string) (res ExecResult) {
 	return
 }
 
-func UpdateToken(username, token string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(
+func UpdateToken(ex mydb.Executor, username, token string) (res ExecResult) {
+	stmt, err := ex.Prepare(
 		"REPLACE INTO tbl_user_token (`user_name`, `user_token`) VALUES (?, ?)")
 	if err != nil {
 		log.Println(err.Error())
@@ -96,8 +96,8 @@ func UpdateToken(username, token string) (res ExecResult) {
 	return
 }
 
-func UserLogout(username string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare("DELETE FROM tbl_user_token WHERE user_name = ?")
+func UserLogout(ex mydb.Executor, username string) (res ExecResult) {
+	stmt, err := ex.Prepare("DELETE FROM tbl_user_token WHERE user_name = ?")
 	if err != nil {
 		log.Println(err.Error())
 		res.Suc = false
@@ -119,8 +119,8 @@ func UserLogout(username string) (res ExecResult) {
 	return
 }
 
-func DeleteUserAccount(username string) (res ExecResult) {
-	tx, err := mydb.DBConn().Begin()
+func DeleteUserAccount(ex mydb.Executor, username string) (res ExecResult) {
+	tx, err := mydb.Begin(ex)
 	if err != nil {
 		log.Println(err.Error())
 		res.Suc = false
@@ -161,9 +161,9 @@ func DeleteUserAccount(username string) (res ExecResult) {
 	return
 }
 
-func GetUserInfo(username string) (res ExecResult) {
+func GetUserInfo(ex mydb.Executor, username string) (res ExecResult) {
 	user := TableUser{}
-	stmt, err := mydb.DBConn().Prepare(
+	stmt, err := ex.Prepare(
 		"SELECT user_name, email, phone, email_validated, phone_validated, signup_at, last_active, profile, status " +
 			"FROM tbl_user WHERE user_name = ? LIMIT 1")
 	if err != nil {
@@ -195,8 +195,8 @@ func GetUserInfo(username string) (res ExecResult) {
 	return
 }
 
-func UserExist(username string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare("SELECT 1 FROM tbl_user WHERE user_name = ? LIMIT 1")
+func UserExist(ex mydb.Executor, username string) (res ExecResult) {
+	stmt, err := ex.Prepare("SELECT 1 FROM tbl_user WHERE user_name = ? LIMIT 1")
 	if err != nil {
 		log.Println(err.Error())
 		res.Suc = false
@@ -1,14 +1,17 @@
 package orm
 
 import (
+	"cloud_distributed_storage/Backend/common"
 	mydb "cloud_distributed_storage/Backend/service/dbproxy/conn"
 	"log"
 	"time"
 )
 
 // OnUserFileUploadFinished 当用户文件上传完成时调用
-func OnUserFileUploadFinished(username, filehash, filename string, filesize int64) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare("insert ignore into tbl_user_file (`user_name`, `file_sha1`, `file_name`, `file_size`, `status`) values (?, ?, ?, ?, 1)")
+// 文件在回收站中时重新上传会将其恢复为正常状态并刷新last_update, 避免被生命周期任务按删除时间清除
+func OnUserFileUploadFinished(ex mydb.Executor, username, filehash, filename string, filesize int64) (res ExecResult) {
+	stmt, err := ex.Prepare("insert into tbl_user_file (`user_name`, `file_sha1`, `file_name`, `file_size`, `status`) values (?, ?, ?, ?, ?) " +
+		"on duplicate key update `status`=values(`status`), `file_name`=values(`file_name`), `last_update`=now()")
 	if err != nil {
 		log.Println("Failed to prepare statement, err: ", err.Error())
 		res.Suc = false
@@ -17,7 +20,7 @@ func OnUserFileUploadFinished(username, filehash, filename string, filesize int6
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(username, filehash, filename, filesize, time.Now())
+	_, err = stmt.Exec(username, filehash, filename, filesize, common.UserFileNormal)
 	if err != nil {
 		log.Println("Failed to execute statement, err: ", err.Error())
 		res.Suc = false
@@ -29,8 +32,8 @@ func OnUserFileUploadFinished(username, filehash, filename string, filesize int6
 }
 
 // QueryUserFileMetas 查询用户文件元信息
-func QueryUserFileMetas(username string, limit int) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare("select file_sha1, file_name, file_size, upload_at, last_update from tbl_user_file where user_name = ? limit ?")
+func QueryUserFileMetas(ex mydb.Executor, username string, limit int) (res ExecResult) {
+	stmt, err := ex.Prepare("select file_sha1, file_name, file_size, upload_at, last_update from tbl_user_file where user_name = ? limit ?")
 	if err != nil {
 		log.Println("Failed to prepare statement, err: ", err.Error())
 		res.Suc = false
@@ -64,8 +67,8 @@ func QueryUserFileMetas(username string, limit int) (res ExecResult) {
 }
 
 // DeleteUserFile 删除用户文件（软删除）
-func DeleteUserFile(username string, filehash string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare("update tbl_user_file set status=2 where user_name=? and file_sha1=? limit 1")
+func DeleteUserFile(ex mydb.Executor, username string, filehash string) (res ExecResult) {
+	stmt, err := ex.Prepare("update tbl_user_file set status=2 where user_name=? and file_sha1=? limit 1")
 	if err != nil {
 		log.Println("Failed to prepare statement, err: ", err.Error())
 		res.Suc = false
@@ -86,8 +89,8 @@ func DeleteUserFile(username string, filehash string) (res ExecResult) {
 }
 
 // RenameFileName 重命名用户文件
-func RenameFileName(username, filehash, filename string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare("update tbl_user_file set file_name=? where user_name=? and file_sha1=? limit 1")
+func RenameFileName(ex mydb.Executor, username, filehash, filename string) (res ExecResult) {
+	stmt, err := ex.Prepare("update tbl_user_file set file_name=? where user_name=? and file_sha1=? limit 1")
 	if err != nil {
 		log.Println("Failed to prepare statement, err: ", err.Error())
 		res.Suc = false
@@ -108,8 +111,8 @@ func RenameFileName(username, filehash, filename string) (res ExecResult) {
 }
 
 // QueryUserFileMeta 查询单个用户文件元信息
-func QueryUserFileMeta(username, filehash string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare("select file_sha1, file_name, file_size, upload_at, last_update from tbl_user_file where user_name = ? and file_sha1 = ? limit 1")
+func QueryUserFileMeta(ex mydb.Executor, username, filehash string) (res ExecResult) {
+	stmt, err := ex.Prepare("select file_sha1, file_name, file_size, upload_at, last_update from tbl_user_file where user_name = ? and file_sha1 = ? limit 1")
 	if err != nil {
 		log.Println("Failed to prepare statement, err: ", err.Error())
 		res.Suc = false
@@ -134,8 +137,8 @@ func QueryUserFileMeta(username, filehash string) (res ExecResult) {
 }
 
 // RestoreUserFile 恢复已删除的用户文件
-func RestoreUserFile(userName string, fileHash string) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(`
+func RestoreUserFile(ex mydb.Executor, userName string, fileHash string) (res ExecResult) {
+	stmt, err := ex.Prepare(`
         UPDATE tbl_user_file
         SET status = 0, last_update = ?
         WHERE user_name = ? AND file_sha1 = ? AND status = 2
@@ -161,8 +164,8 @@ func RestoreUserFile(userName string, fileHash string) (res ExecResult) {
 }
 
 // QueryUserFilesByStatus 根据状态查询用户文件
-func QueryUserFilesByStatus(userName string, status int, limit int) (res ExecResult) {
-	stmt, err := mydb.DBConn().Prepare(`
+func QueryUserFilesByStatus(ex mydb.Executor, userName string, status int, limit int) (res ExecResult) {
+	stmt, err := ex.Prepare(`
         SELECT file_sha1, file_name, file_size, upload_at, last_update
         FROM tbl_user_file
         WHERE user_name = ? AND status = ?
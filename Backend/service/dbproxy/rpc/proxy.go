@@ -1,46 +1,85 @@
 package rpc
 
 import (
-	"bytes"
+	mydb "cloud_distributed_storage/Backend/service/dbproxy/conn"
 	"cloud_distributed_storage/Backend/service/dbproxy/mapper"
 	"cloud_distributed_storage/Backend/service/dbproxy/orm"
 	dbproxy "cloud_distributed_storage/Backend/service/dbproxy/proto"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"fmt"
+	"log"
 )
 
 type DBProxy struct{}
 
+// ExecuteAction : 执行一个或多个orm操作
+// transaction为true时所有操作在同一事务中执行, 任一操作失败则回滚并中止;
+// sequence为true时按顺序执行并在首个失败处中止; resultType为1时只返回最后一个结果
+// 非事务请求中的操作全部为只读时在只读副本上执行
 func (d *DBProxy) ExecuteAction(ctx context.Context, req *dbproxy.ReqExec, res *dbproxy.ResExec) error {
-	resList := make([]orm.ExecResult, len(req.Actions))
-
-	for index, singleAction := range req.Actions {
-		var params []interface{}
-		dec := json.NewDecoder(bytes.NewReader(singleAction.Params))
-		dec.UseNumber()
-		if err := dec.Decode(&params); err != nil {
-			resList[index] = orm.ExecResult{
-				Suc: false,
-				Msg: "Invalid params",
-			}
-			continue
+	var ex mydb.Executor = mydb.DBConn()
+	if !req.Transaction && readOnly(req.Actions) {
+		ex = mydb.ReadConn()
+	}
+	var tx *sql.Tx
+	if req.Transaction {
+		var err error
+		if tx, err = mydb.DBConn().BeginTx(ctx, nil); err != nil {
+			log.Println("Failed to begin transaction, err: ", err.Error())
+			res.Code = -1
+			res.Msg = "Failed to begin transaction"
+			return nil
 		}
+		ex = tx
+	}
 
-		for k, v := range params {
-			if _, ok := v.(json.Number); ok {
-				params[k], _ = v.(json.Number).Int64()
+	// 事务中的操作失败后必须回滚, 因此事务总是在首个失败处中止
+	abortOnFail := req.Sequence || req.Transaction
+	resList := make([]orm.ExecResult, 0, len(req.Actions))
+	failed := false
+	for _, singleAction := range req.Actions {
+		execRes, err := execSingle(ex, singleAction)
+		if err != nil {
+			// 调用本身失败(而非orm操作失败)时通过Code/Msg返回给调用方
+			log.Println(err.Error())
+			res.Code = -2
+			res.Msg = err.Error()
+		}
+		resList = append(resList, execRes)
+		if !execRes.Suc {
+			failed = true
+			if abortOnFail {
+				break
 			}
 		}
+	}
 
-		execRes, err := mapper.FunCall(singleAction.Name, params...)
+	if tx != nil {
+		var err error
+		if failed {
+			err = fmt.Errorf("action %d failed", len(resList)-1)
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
 		if err != nil {
-			resList[index] = orm.ExecResult{
-				Suc: false,
-				Msg: "function call failed",
+			// 事务未提交, 之前成功的操作也已失效
+			log.Println("Transaction rolled back: ", err.Error())
+			res.Code = -1
+			res.Msg = "Transaction rolled back: " + err.Error()
+			for i := range resList {
+				if resList[i].Suc {
+					resList[i].Suc = false
+					resList[i].Msg = "Transaction rolled back"
+				}
 			}
-			continue
 		}
-		resList[index] = execRes[0].Interface().(orm.ExecResult)
+	}
+
+	if req.ResultType == 1 && len(resList) > 0 {
+		resList = resList[len(resList)-1:]
 	}
 
 	var err error
@@ -51,3 +90,30 @@ func (d *DBProxy) ExecuteAction(ctx context.Context, req *dbproxy.ReqExec, res *
 	}
 	return nil
 }
+
+// readOnly : actions是否全部为只读操作
+func readOnly(actions []*dbproxy.SingleAction) bool {
+	if len(actions) == 0 {
+		return false
+	}
+	for _, a := range actions {
+		if !mapper.ReadOnly(a.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// execSingle : 执行一个操作, 操作不存在、参数无效或执行panic时返回error
+func execSingle(ex mydb.Executor, singleAction *dbproxy.SingleAction) (execRes orm.ExecResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("call %s panic: %v\n", singleAction.Name, r)
+			err = fmt.Errorf("%s: %v", singleAction.Name, r)
+		}
+		if err != nil {
+			execRes = orm.ExecResult{Suc: false, Msg: err.Error()}
+		}
+	}()
+	return mapper.FunCall(ex, singleAction.Name, singleAction.Params)
+}
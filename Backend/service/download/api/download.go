@@ -4,13 +4,12 @@ import (
 	"cloud_distributed_storage/Backend/common"
 	cfg "cloud_distributed_storage/Backend/config"
 	dbcli "cloud_distributed_storage/Backend/service/dbproxy/client"
-	minio "cloud_distributed_storage/Backend/store/minio"
+	"cloud_distributed_storage/Backend/store/replica"
 	s3Client "cloud_distributed_storage/Backend/store/s3"
 	"context"
 	"fmt"
 	"log"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -48,20 +47,21 @@ func DownloadURLHandler(c *gin.Context) {
 		return
 	}
 
-	tblFile := dbcli.ToTableFile(dbResp.Data)
+	tblFile := dbResp.Data
 
-	// TODO: 判断文件存在S3，还是Ceph，还是在本地
-	if strings.HasPrefix(tblFile.FileAddr.String, cfg.TempLocalRootDir) ||
-		strings.HasPrefix(tblFile.FileAddr.String, cfg.MinioRootDir) {
-		username := c.Request.FormValue("username")
-		token := c.Request.FormValue("token")
-		tmpURL := fmt.Sprintf("http://%s/file/download?filehash=%s&username=%s&token=%s",
-			c.Request.Host, filehash, username, token)
-		c.Data(http.StatusOK, "application/octet-stream", []byte(tmpURL))
-	} else if strings.HasPrefix(tblFile.FileAddr.String, cfg.S3RootDir) {
+	// 主位置所在存储不可用时改用其他副本
+	fileAddr, storeType, err := replica.Pick(c.Request.Context(), filehash, tblFile.FileAddr.String)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusOK, gin.H{
+			"code": common.StatusServerError,
+			"msg":  "server error",
+		})
+		return
+	}
+	if storeType == common.StoreS3 {
 		// s3下载url
-		s3path := cfg.S3RootDir + filehash
-		signedURL, err := GeneratePresignedURL(cfg.S3_BUCKET_NAME, s3path, 15*time.Minute)
+		signedURL, err := GeneratePresignedURL(cfg.S3_BUCKET_NAME, fileAddr, 15*time.Minute)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"code": common.StatusServerError,
@@ -70,14 +70,20 @@ func DownloadURLHandler(c *gin.Context) {
 			return
 		}
 		c.Data(http.StatusOK, "application/octet-stream", []byte(signedURL))
+		return
 	}
+	// 本地、minio中及分块去重存储的文件通过下载服务中转
+	username := c.Request.FormValue("username")
+	token := c.Request.FormValue("token")
+	tmpURL := fmt.Sprintf("http://%s/file/download?filehash=%s&username=%s&token=%s",
+		c.Request.Host, filehash, username, token)
+	c.Data(http.StatusOK, "application/octet-stream", []byte(tmpURL))
 }
 
-// DownloadHandler : 文件下载接口
+// DownloadHandler : 文件下载接口, 支持Range及条件请求, 内容从任意存储流式读取
 func DownloadHandler(c *gin.Context) {
 	fsha1 := c.Request.FormValue("filehash")
 	username := c.Request.FormValue("username")
-	// TODO: 处理异常情况
 	fResp, ferr := dbcli.GetFileMeta(fsha1)
 	ufResp, uferr := dbcli.QueryUserFileMeta(username, fsha1)
 	if ferr != nil || uferr != nil || !fResp.Suc || !ufResp.Suc {
@@ -89,17 +95,31 @@ func DownloadHandler(c *gin.Context) {
 			})
 		return
 	}
-	uniqFile := dbcli.ToTableFile(fResp.Data)
-	userFile := dbcli.ToTableUserFile(ufResp.Data)
+	uniqFile := fResp.Data
+	userFile := ufResp.Data
+
+	served := serveFile(c, fileContent{
+		FileHash: fsha1,
+		Addr:     uniqFile.FileAddr.String,
+		Name:     userFile.FileName,
+		Size:     uniqFile.FileSize.Int64,
+		ModTime:  parseDBTime(userFile.UploadAt),
+	})
+	if !served {
+		return
+	}
+
+	// 更新下载次数, 仅记录日志, 不影响下载
+	if _, err := dbcli.UpdateUserFileDownloadCount(username, fsha1); err != nil {
+		log.Printf("Failed to update download count: %v", err)
+	}
+}
 
-	if strings.HasPrefix(uniqFile.FileAddr.String, cfg.TempLocalRootDir) {
-		// 本地文件， 直接下载
-		c.FileAttachment(uniqFile.FileAddr.String, userFile.FileName)
-	} else if strings.HasPrefix(uniqFile.FileAddr.String, cfg.MinioRootDir) {
-		// minio中的文件，通过minio api先下载
-		data, _ := minio.GetObject("filestore", uniqFile.FileAddr.String)
-		//	c.Header("content-type", "application/octect-stream")
-		c.Header("content-disposition", "attachment; filename=\""+userFile.FileName+"\"")
-		c.Data(http.StatusOK, "application/octect-stream", data)
+// parseDBTime : 解析数据库返回的时间字符串, 失败时返回零值(不输出Last-Modified)
+func parseDBTime(s string) time.Time {
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local); err == nil {
+		return t
 	}
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
 }
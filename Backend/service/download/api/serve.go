@@ -0,0 +1,179 @@
+package api
+
+import (
+	"cloud_distributed_storage/Backend/store/replica"
+	"cloud_distributed_storage/Backend/util"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fileContent : 待输出的文件, 内容从主位置读取, 不可用时切换到副本
+type fileContent struct {
+	FileHash string
+	Addr     string
+	Name     string
+	Size     int64
+	ModTime  time.Time
+}
+
+// serveFile : 流式输出文件内容, 支持单区间/多区间Range请求及条件请求
+// ETag为文件sha1; 返回是否从头输出了文件内容(HEAD请求除外), 调用方据此统计下载次数
+func serveFile(c *gin.Context, f fileContent) bool {
+	etag := `"` + f.FileHash + `"`
+	h := c.Writer.Header()
+	h.Set("ETag", etag)
+	h.Set("Accept-Ranges", "bytes")
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": f.Name}))
+	if !f.ModTime.IsZero() {
+		h.Set("Last-Modified", f.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	// 1. 条件请求, 文件按sha1寻址, 内容不会变化
+	if util.NotModified(c.GetHeader("If-None-Match"), c.GetHeader("If-Modified-Since"), etag, f.ModTime) {
+		h.Del("Content-Disposition")
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return false
+	}
+
+	// 2. 解析Range, If-Range不匹配时忽略Range返回完整内容
+	rangeHeader := c.GetHeader("Range")
+	if !util.RangeApplies(c.GetHeader("If-Range"), etag, f.ModTime) {
+		rangeHeader = ""
+	}
+	ranges, err := util.ParseRange(rangeHeader, f.Size)
+	if err != nil {
+		h.Set("Content-Range", fmt.Sprintf("bytes */%d", f.Size))
+		c.String(http.StatusRequestedRangeNotSatisfiable, err.Error())
+		return false
+	}
+	// 区间总长超过文件大小时直接返回完整内容, 避免放大读取
+	var sum int64
+	for _, r := range ranges {
+		sum += r.Length
+	}
+	if sum > f.Size {
+		ranges = nil
+	}
+
+	// 3. 单区间先打开内容再写入状态码, 存储全部不可用时返回5xx而不是带Content-Length的空响应
+	if len(ranges) <= 1 {
+		r, status := util.HTTPRange{Start: 0, Length: f.Size}, http.StatusOK
+		if len(ranges) == 1 {
+			r, status = ranges[0], http.StatusPartialContent
+			h.Set("Content-Range", r.ContentRange(f.Size))
+		}
+		rd, err := openRange(c, f, r)
+		if err != nil {
+			unavailable(c)
+			return false
+		}
+		h.Set("Content-Type", "application/octet-stream")
+		h.Set("Content-Length", strconv.FormatInt(r.Length, 10))
+		c.Status(status)
+		return sendRange(c, f, rd, r.Length, c.Writer) == nil && r.Start == 0 && c.Request.Method != http.MethodHead
+	}
+
+	// 4. 多区间以multipart/byteranges返回, 先确定可读的存储位置, 再计算总长度以便设置Content-Length
+	addr, _, err := replica.Pick(c.Request.Context(), f.FileHash, f.Addr)
+	if err != nil {
+		log.Printf("failed to pick location of %s: %v\n", f.FileHash, err)
+		unavailable(c)
+		return false
+	}
+	f.Addr = addr
+	counter := &countingWriter{}
+	mw := multipart.NewWriter(counter)
+	for _, r := range ranges {
+		mw.CreatePart(rangeHeaders(r, f.Size))
+		counter.n += r.Length
+	}
+	mw.Close()
+	boundary := mw.Boundary()
+
+	h.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+	h.Set("Content-Length", strconv.FormatInt(counter.n, 10))
+	c.Status(http.StatusPartialContent)
+	if c.Request.Method == http.MethodHead {
+		c.Writer.WriteHeaderNow()
+		return false
+	}
+
+	mw = multipart.NewWriter(c.Writer)
+	mw.SetBoundary(boundary)
+	for _, r := range ranges {
+		part, err := mw.CreatePart(rangeHeaders(r, f.Size))
+		var rd io.ReadCloser
+		if err == nil {
+			rd, err = openRange(c, f, r)
+		}
+		if err == nil {
+			err = sendRange(c, f, rd, r.Length, part)
+		}
+		if err != nil {
+			return false
+		}
+	}
+	mw.Close()
+	return ranges[0].Start == 0
+}
+
+// openRange : 打开区间内容, HEAD请求及空区间无需读取存储, 返回nil
+func openRange(c *gin.Context, f fileContent, r util.HTTPRange) (io.ReadCloser, error) {
+	if c.Request.Method == http.MethodHead || r.Length == 0 {
+		return nil, nil
+	}
+	rd, err := replica.Open(c.Request.Context(), f.FileHash, f.Addr, r.Start, r.Length)
+	if err != nil {
+		log.Printf("failed to open %s: %v\n", f.FileHash, err)
+	}
+	return rd, err
+}
+
+// sendRange : 将openRange打开的内容写入w, rd为nil时只输出响应头
+func sendRange(c *gin.Context, f fileContent, rd io.ReadCloser, length int64, w io.Writer) error {
+	if rd == nil {
+		c.Writer.WriteHeaderNow()
+		return nil
+	}
+	defer rd.Close()
+	_, err := io.CopyN(w, rd, length)
+	if err != nil {
+		log.Printf("failed to send %s: %v\n", f.FileHash, err)
+	}
+	return err
+}
+
+// unavailable : 文件在所有存储位置均不可读, 清除已设置的下载相关响应头后返回503
+func unavailable(c *gin.Context) {
+	h := c.Writer.Header()
+	h.Del("Content-Disposition")
+	h.Del("Content-Range")
+	c.String(http.StatusServiceUnavailable, "文件暂不可用")
+}
+
+func rangeHeaders(r util.HTTPRange, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Type":  {"application/octet-stream"},
+		"Content-Range": {r.ContentRange(size)},
+	}
+}
+
+// countingWriter : 只统计写入的字节数
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
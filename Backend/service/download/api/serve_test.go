@@ -0,0 +1,116 @@
+package api
+
+import (
+	cfg "cloud_distributed_storage/Backend/config"
+	"cloud_distributed_storage/Backend/util"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFile(t *testing.T) fileContent {
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	hash := util.Sha1(data)
+	addr := cfg.TempLocalRootDir + hash
+	require.NoError(t, os.MkdirAll(cfg.TempLocalRootDir, 0744))
+	require.NoError(t, os.WriteFile(addr, data, 0644))
+	t.Cleanup(func() { os.Remove(addr) })
+	return fileContent{
+		FileHash: hash,
+		Addr:     addr,
+		Name:     "a.txt",
+		Size:     int64(len(data)),
+		ModTime:  time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+	}
+}
+
+func serve(f fileContent, method string, headers map[string]string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/file/download", nil)
+	for k, v := range headers {
+		c.Request.Header.Set(k, v)
+	}
+	serveFile(c, f)
+	return w
+}
+
+func TestServeFile(t *testing.T) {
+	f := testFile(t)
+	etag := `"` + f.FileHash + `"`
+
+	w := serve(f, http.MethodGet, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789abcdefghijklmnopqrstuvwxyz", w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, "Wed, 01 May 2024 08:00:00 GMT", w.Header().Get("Last-Modified"))
+
+	w = serve(f, http.MethodGet, map[string]string{"Range": "bytes=-6"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "uvwxyz", w.Body.String())
+	assert.Equal(t, "bytes 30-35/36", w.Header().Get("Content-Range"))
+
+	w = serve(f, http.MethodGet, map[string]string{"Range": "bytes=30-"})
+	assert.Equal(t, "uvwxyz", w.Body.String())
+
+	w = serve(f, http.MethodGet, map[string]string{"Range": "bytes=40-"})
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	assert.Equal(t, "bytes */36", w.Header().Get("Content-Range"))
+
+	w = serve(f, http.MethodGet, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = serve(f, http.MethodGet, map[string]string{"Range": "bytes=0-3", "If-Range": `"stale"`})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, w.Body.String(), 36)
+
+	f.Name = `a"b.txt`
+	w = serve(f, http.MethodHead, nil)
+	_, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+	require.NoError(t, err)
+	assert.Equal(t, `a"b.txt`, params["filename"])
+
+	w = serve(f, http.MethodHead, map[string]string{"Range": "bytes=0-3"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "4", w.Header().Get("Content-Length"))
+	assert.Empty(t, w.Body.String())
+}
+
+func TestServeFileMultiRange(t *testing.T) {
+	f := testFile(t)
+	w := serve(f, http.MethodGet, map[string]string{"Range": "bytes=0-1, 10-12"})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, w.Header().Get("Content-Length"), strconv.Itoa(w.Body.Len()))
+
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	var bodies, ranges []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, _ := io.ReadAll(part)
+		bodies = append(bodies, string(data))
+		ranges = append(ranges, part.Header.Get("Content-Range"))
+	}
+	assert.Equal(t, []string{"01", "abc"}, bodies)
+	assert.Equal(t, "bytes 0-1/36,bytes 10-12/36", strings.Join(ranges, ","))
+}
@@ -20,9 +20,9 @@ func Router() *gin.Engine {
 	// 使用gin插件支持跨域请求
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:  []string{"*"}, // []string{"http://localhost:8080"},
-		AllowMethods:  []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:  []string{"Origin", "Range", "x-requested-with", "content-Type"},
-		ExposeHeaders: []string{"Content-Length", "Accept-Ranges", "Content-Range", "Content-Disposition"},
+		AllowMethods:  []string{"GET", "HEAD", "POST", "OPTIONS"},
+		AllowHeaders:  []string{"Origin", "Range", "If-Range", "If-None-Match", "If-Modified-Since", "x-requested-with", "content-Type"},
+		ExposeHeaders: []string{"Content-Length", "Accept-Ranges", "Content-Range", "Content-Disposition", "ETag", "Last-Modified"},
 		// AllowCredentials: true,
 	}))
 
@@ -30,6 +30,7 @@ func Router() *gin.Engine {
 
 	// 文件下载相关接口
 	router.GET("/file/download", api.DownloadHandler)
+	router.HEAD("/file/download", api.DownloadHandler)
 	router.POST("/file/downloadurl", api.DownloadURLHandler)
 
 	return router
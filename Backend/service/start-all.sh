@@ -23,7 +23,7 @@ check_process() {
 # 编译service可执行文件
 build_service() {
     echo "正在编译 $1 服务..."
-    go build -o service/bin/$1 service/$1/main.go
+    go build -o service/bin/$1 ./service/$1
     resbin=$(ls service/bin/ | grep $1)
     echo -e "\033[32m编译完成:\033[0m service/bin/$resbin"
 }
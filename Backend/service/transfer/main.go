@@ -12,6 +12,7 @@ import (
 	"github.com/asim/go-micro/v3/registry"
 	"github.com/urfave/cli/v2"
 	"log"
+	"os"
 	"time"
 )
 
@@ -24,7 +25,12 @@ func startRPCService() {
 		micro.Registry(reg),
 		micro.RegisterTTL(time.Second*10),     // TTL指定从上一次心跳间隔起，超过这个时间服务会被服务发现移除
 		micro.RegisterInterval(time.Second*5), // 让服务在指定时间内重新注册，保持TTL获取的注册时间有效
-		micro.Flags(common.CustomFlags...),
+		micro.Flags(append(common.CustomFlags,
+			&cli.IntFlag{
+				Name:  "replay",
+				Value: -1,
+				Usage: "replay N messages from the transfer error queue (0 for all) and exit",
+			})...),
 	)
 	service.Init(
 		micro.Action(func(c *cli.Context) error {
@@ -34,6 +40,11 @@ func startRPCService() {
 				log.Println("custom mq address: " + mqhost)
 				mq.UpdateRabbitHost(mqhost)
 			}
+			// 将错误队列中的消息重新投递到转移队列后退出
+			if limit := c.Int("replay"); limit >= 0 {
+				replayErrQueue(limit)
+				os.Exit(0)
+			}
 			return nil
 		}),
 	)
@@ -41,6 +52,7 @@ func startRPCService() {
 	// 初始化dbproxy client
 	dbproxy.Init(service)
 
+	// service.Run在收到SIGTERM/SIGINT后返回
 	if err := service.Run(); err != nil {
 		fmt.Println(err)
 	}
@@ -56,16 +68,45 @@ func startTranserService() {
 	// 初始化mq client
 	mq.Init()
 
+	// 生命周期规则: 冷数据迁移及过期文件清除, 迁移任务经由转移队列执行
+	if config.LifecycleEnable {
+		process.StartLifecycle(config.LifecycleInterval)
+	}
+
 	mq.StartConsume(
 		config.TransS3QueueName,
+		config.TransS3ErrQueueName,
 		"transfer_s3",
+		config.TransferWorkers,
 		process.Transfer)
 }
 
+// replayErrQueue : 重放转移失败的消息
+func replayErrQueue(limit int) {
+	n, err := mq.ReplayErrQueue(config.TransS3ErrQueueName, config.TransS3QueueName, limit)
+	if err != nil {
+		log.Println(err.Error())
+	}
+	log.Printf("replayed %d messages from %s\n", n, config.TransS3ErrQueueName)
+}
+
 func main() {
+	// 清理本地临时目录中已迁移或已失效的文件
+	process.StartSweeper(config.TempSweepInterval)
+	// 巡检存储中的对象是否损坏或丢失
+	if config.ScrubEnable {
+		process.StartScrubber(config.ScrubInterval)
+	}
+
 	// 文件转移服务
 	go startTranserService()
 
 	// rpc 服务
 	startRPCService()
+
+	// 停止接收新的转移任务, 等待处理中的任务完成后退出
+	if config.AsyncTransferEnable {
+		log.Println("文件转移服务停止中，等待处理中的任务完成...")
+		mq.StopConsume(config.TransferShutdownTimeout)
+	}
 }
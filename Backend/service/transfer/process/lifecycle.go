@@ -0,0 +1,125 @@
+package process
+
+import (
+	"cloud_distributed_storage/Backend/common"
+	cfg "cloud_distributed_storage/Backend/config"
+	"cloud_distributed_storage/Backend/mq"
+	dbcli "cloud_distributed_storage/Backend/service/dbproxy/client"
+	"cloud_distributed_storage/Backend/store"
+	"cloud_distributed_storage/Backend/store/replica"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Rule : 生命周期规则, Apply处理一批到期的文件, 返回处理的文件数
+type Rule struct {
+	Name  string
+	Apply func(ctx context.Context, now time.Time) (int, error)
+}
+
+// Rules : 按顺序执行的生命周期规则
+var Rules = []Rule{
+	{Name: "cold-tier", Apply: TransitionRule(cfg.ColdTierFrom, cfg.ColdTierTo, cfg.ColdTierAfter)},
+	{Name: "purge-deleted", Apply: ExpireRule(cfg.PurgeDeletedAfter)},
+}
+
+// StartLifecycle : 启动后台协程, 周期性执行生命周期规则
+func StartLifecycle(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			RunLifecycle(context.Background())
+		}
+	}()
+}
+
+// RunLifecycle : 依次执行所有生命周期规则, 单条规则失败不影响其他规则
+func RunLifecycle(ctx context.Context) {
+	now := time.Now()
+	for _, rule := range Rules {
+		n, err := rule.Apply(ctx, now)
+		if err != nil {
+			log.Printf("lifecycle rule %s failed after %d files: %v\n", rule.Name, n, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("lifecycle rule %s processed %d files\n", rule.Name, n)
+		}
+	}
+}
+
+// TransitionRule : 将from存储中超过after未被访问的文件迁移到to存储
+// 只投递转移任务, 由转移消费者完成复制、校验、更新file_addr及删除源对象
+func TransitionRule(from, to common.StoreType, after time.Duration) func(context.Context, time.Time) (int, error) {
+	return func(ctx context.Context, now time.Time) (int, error) {
+		resp, err := dbcli.GetColdFiles(store.Addr(from, ""), now.Add(-after), cfg.LifecycleBatchSize)
+		if err != nil {
+			return 0, err
+		}
+		if resp == nil || !resp.Suc {
+			return 0, fmt.Errorf("failed to query cold files in store %d", from)
+		}
+
+		n := 0
+		for _, f := range resp.Data {
+			data := mq.TransferData{
+				FileHash:      f.FileHash,
+				CurLocation:   f.FileAddr.String,
+				DestLocation:  store.Addr(to, f.FileHash),
+				DestStoreType: to,
+				Move:          true,
+			}
+			// 任务记录是下一轮跳过该文件的依据, 无法记录时本轮不投递, 避免重复迁移
+			if data.JobID = createJob(data); data.JobID == 0 {
+				continue
+			}
+			pubData, _ := json.Marshal(data)
+			if !mq.Publish(cfg.TransExchangeName, cfg.TransS3RoutingKey, pubData) {
+				return n, fmt.Errorf("failed to publish transfer of %s", f.FileHash)
+			}
+			n++
+		}
+		return n, nil
+	}
+}
+
+// ExpireRule : 彻底清除被用户删除超过after的文件, 不再被任何用户引用的文件同时删除所有存储中的对象
+func ExpireRule(after time.Duration) func(context.Context, time.Time) (int, error) {
+	return func(ctx context.Context, now time.Time) (int, error) {
+		resp, err := dbcli.GetExpiredUserFiles(now.Add(-after), cfg.LifecycleBatchSize)
+		if err != nil {
+			return 0, err
+		}
+		if resp == nil || !resp.Suc {
+			return 0, fmt.Errorf("failed to query expired user files")
+		}
+
+		n := 0
+		for _, uf := range resp.Data {
+			resp, err := dbcli.PurgeUserFile(uf.UserName, uf.FileHash)
+			if err != nil || resp == nil || !resp.Suc {
+				log.Printf("failed to purge %s of %s: %v\n", uf.FileHash, uf.UserName, err)
+				continue
+			}
+			n++
+			if addr := resp.Data; addr != "" {
+				replica.Purge(ctx, uf.FileHash, addr)
+			}
+		}
+		return n, nil
+	}
+}
+
+// createJob : 记录生命周期发起的转移任务, 失败时返回0
+func createJob(data mq.TransferData) int64 {
+	resp, err := dbcli.CreateTransferJob(data.FileHash, "", data.CurLocation, data.DestLocation, data.DestStoreType)
+	if err != nil || resp == nil || !resp.Suc {
+		log.Printf("failed to create transfer job for %s: %v\n", data.FileHash, err)
+		return 0
+	}
+	return resp.Data
+}
@@ -0,0 +1,202 @@
+package process
+
+import (
+	"cloud_distributed_storage/Backend/common"
+	cfg "cloud_distributed_storage/Backend/config"
+	dbcli "cloud_distributed_storage/Backend/service/dbproxy/client"
+	"cloud_distributed_storage/Backend/service/dbproxy/orm"
+	"cloud_distributed_storage/Backend/store"
+	"cloud_distributed_storage/Backend/store/dedup"
+	"cloud_distributed_storage/Backend/store/replica"
+	"cloud_distributed_storage/Backend/util"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// errCorrupt : 对象的大小或sha1与文件表记录不符
+var errCorrupt = errors.New("object does not match file_sha1")
+
+// ScrubStats : 一轮巡检的统计
+type ScrubStats struct {
+	Checked  int
+	Corrupt  int
+	Missing  int
+	Repaired int
+}
+
+// StartScrubber : 启动后台协程, 周期性巡检存储中的对象
+func StartScrubber(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			Scrub(context.Background())
+		}
+	}()
+}
+
+// Scrub : 按id分批遍历tbl_file, 读回每个文件的主位置及所有副本重新计算sha1
+// 损坏或丢失的副本在开启ScrubRepairEnable时用完好的副本覆盖修复;
+// 无法修复时若主位置损坏且有完好的副本, 将该副本提升为主位置; 没有完好副本时将文件标记为FileCorrupt/FileMissing;
+// 损坏的副本删除副本记录
+func Scrub(ctx context.Context) ScrubStats {
+	var stats ScrubStats
+	var afterID int64
+	for {
+		resp, err := dbcli.GetFileMetaList(afterID, cfg.ScrubBatchSize)
+		if err != nil || resp == nil || !resp.Suc {
+			log.Printf("scrub: failed to list files after id %d: %v\n", afterID, err)
+			break
+		}
+		files := resp.Data
+		for _, f := range files {
+			afterID = f.ID
+			scrubFile(ctx, f, &stats)
+		}
+		if len(files) < cfg.ScrubBatchSize {
+			break
+		}
+	}
+	log.Printf("scrub finished: %d checked, %d corrupt, %d missing, %d repaired\n",
+		stats.Checked, stats.Corrupt, stats.Missing, stats.Repaired)
+	return stats
+}
+
+func scrubFile(ctx context.Context, f orm.TableFile, stats *ScrubStats) {
+	primary := f.FileAddr.String
+	var good string
+	bad := map[string]error{}
+	for _, addr := range replica.Locations(f.FileHash, primary) {
+		err := checkObject(ctx, addr, f.FileSize.Int64, f.FileHash)
+		switch {
+		case err == nil:
+			if good == "" {
+				good = addr
+			}
+		case errors.Is(err, store.ErrNotFound) || errors.Is(err, errCorrupt):
+			bad[addr] = err
+		default:
+			// 存储暂时不可用等错误无法判断对象是否完好, 留到下一轮
+			log.Printf("scrub: failed to check %s: %v\n", addr, err)
+		}
+	}
+	stats.Checked++
+
+	for addr, err := range bad {
+		status := common.FileCorrupt
+		if errors.Is(err, store.ErrNotFound) {
+			status = common.FileMissing
+			stats.Missing++
+		} else {
+			stats.Corrupt++
+		}
+		log.Printf("scrub: %s of %s: %v\n", addr, f.FileHash, err)
+
+		if cfg.ScrubRepairEnable && good != "" && !dedup.IsManifest(addr) {
+			rerr := repairObject(ctx, good, addr, f.FileSize.Int64, f.FileHash)
+			if rerr == nil {
+				log.Printf("scrub: repaired %s from %s\n", addr, good)
+				stats.Repaired++
+				continue
+			}
+			log.Printf("scrub: failed to repair %s from %s: %v\n", addr, good, rerr)
+		}
+
+		if addr == primary && good != "" {
+			if perr := promoteReplica(ctx, f.FileHash, primary, good, err); perr != nil {
+				log.Printf("scrub: failed to promote %s of %s: %v\n", good, f.FileHash, perr)
+			}
+			continue
+		}
+
+		var resp *dbcli.Result[struct{}]
+		if addr == primary {
+			resp, err = dbcli.UpdateFileStatus(f.FileHash, status)
+		} else {
+			resp, err = dbcli.RemoveFileReplica(f.FileHash, addr)
+		}
+		if err != nil || resp == nil || !resp.Suc {
+			log.Printf("scrub: failed to flag %s of %s: %v\n", addr, f.FileHash, err)
+		}
+	}
+}
+
+// promoteReplica : 主位置损坏或丢失时将完好的副本good作为新的file_addr, 文件保持可用
+// 副本记录随之删除; 原主位置的损坏对象不再被引用, 一并删除
+func promoteReplica(ctx context.Context, filehash, primary, good string, cause error) error {
+	resp, err := dbcli.UpdateFileLocation(filehash, good)
+	if err != nil {
+		return err
+	}
+	if resp == nil || !resp.Suc {
+		return errors.New("failed to update file location")
+	}
+	log.Printf("scrub: promoted replica %s of %s to primary\n", good, filehash)
+
+	if resp, err := dbcli.RemoveFileReplica(filehash, good); err != nil || resp == nil || !resp.Suc {
+		log.Printf("scrub: failed to remove replica record %s of %s: %v\n", good, filehash, err)
+	}
+	if errors.Is(cause, errCorrupt) && !dedup.IsManifest(primary) {
+		if st, err := store.ByLocation(primary); err == nil {
+			if err = st.Delete(ctx, primary); err != nil {
+				log.Printf("scrub: failed to delete corrupt object %s: %v\n", primary, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkObject : 读回addr处的文件, 校验大小及sha1
+// 对象不存在时返回store.ErrNotFound, 内容不符时返回errCorrupt
+func checkObject(ctx context.Context, addr string, size int64, filehash string) error {
+	if !dedup.IsManifest(addr) {
+		st, err := store.ByLocation(addr)
+		if err != nil {
+			return err
+		}
+		info, err := st.Stat(ctx, addr)
+		if err != nil {
+			return err
+		}
+		if info.Size != size {
+			return fmt.Errorf("%w: size %d, expect %d", errCorrupt, info.Size, size)
+		}
+	}
+
+	rd, err := dedup.Open(ctx, addr, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	sha1Stream := &util.Sha1Stream{}
+	if _, err = io.Copy(sha1Stream, rd); err != nil {
+		return err
+	}
+	if !strings.EqualFold(sha1Stream.Sum(), filehash) {
+		return fmt.Errorf("%w: sha1 %s", errCorrupt, sha1Stream.Sum())
+	}
+	return nil
+}
+
+// repairObject : 用src处完好的文件覆盖dest, 并校验修复结果
+func repairObject(ctx context.Context, src, dest string, size int64, filehash string) error {
+	dst, err := store.ByLocation(dest)
+	if err != nil {
+		return err
+	}
+	rd, err := dedup.Open(ctx, src, 0, -1)
+	if err != nil {
+		return err
+	}
+	err = dst.Put(ctx, dest, rd, size)
+	rd.Close()
+	if err != nil {
+		return err
+	}
+	return verifyRemote(ctx, dst, dest, size, filehash)
+}
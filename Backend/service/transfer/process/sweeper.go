@@ -0,0 +1,86 @@
+package process
+
+import (
+	cfg "cloud_distributed_storage/Backend/config"
+	dbcli "cloud_distributed_storage/Backend/service/dbproxy/client"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// sha1Name : 上传完成的本地文件以sha1命名, 其余为上传中途留下的临时文件
+var sha1Name = regexp.MustCompile("^[0-9a-fA-F]{40}$")
+
+// StartSweeper : 启动后台协程, 周期性清理本地临时目录
+func StartSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			Sweep()
+		}
+	}()
+}
+
+// Sweep : 对照tbl_file清理TempLocalRootDir中的文件
+// 删除文件表中不存在(上传失败或已删除)及已迁移到其他存储的文件, file_addr仍指向本地的文件保留
+func Sweep() {
+	entries, err := os.ReadDir(cfg.TempLocalRootDir)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	var removed int
+	var freed int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || time.Since(info.ModTime()) < cfg.TempSweepMinAge {
+			continue
+		}
+		// 分块去重使用本地存储时的分块由引用计数管理
+		if strings.HasPrefix(entry.Name(), "chunk_") {
+			continue
+		}
+
+		path := filepath.Join(cfg.TempLocalRootDir, entry.Name())
+		if sha1Name.MatchString(entry.Name()) && !sweepable(entry.Name(), path) {
+			continue
+		}
+		if err = os.Remove(path); err != nil {
+			log.Println(err.Error())
+			continue
+		}
+		removed++
+		freed += info.Size()
+	}
+	if removed > 0 {
+		log.Printf("sweeper removed %d local files, %d bytes freed\n", removed, freed)
+	}
+}
+
+// sweepable : 文件已不在文件表中, 或文件表记录的位置已不是本地路径, 且本地文件未登记为副本
+// 不论文件状态, 禁用、损坏或丢失的文件仍指向本地时也保留; 查询失败时保守地保留文件
+func sweepable(filehash, path string) bool {
+	resp, err := dbcli.GetFileRecord(filehash)
+	if err != nil || resp == nil {
+		return false
+	}
+	if !resp.NotFound() && (!resp.Suc || resp.Data.FileAddr.String == path) {
+		return false
+	}
+
+	replicas, err := dbcli.GetFileReplicas(filehash)
+	if err != nil || replicas == nil || !replicas.Suc {
+		return false
+	}
+	for _, r := range replicas.Data {
+		if r.FileAddr == path {
+			return false
+		}
+	}
+	return true
+}
@@ -1,54 +1,134 @@
 package process
 
 import (
-	"bufio"
-	cfg "cloud_distributed_storage/Backend/config"
+	"cloud_distributed_storage/Backend/common"
 	"cloud_distributed_storage/Backend/mq"
 	dbcli "cloud_distributed_storage/Backend/service/dbproxy/client"
-	"cloud_distributed_storage/Backend/store/s3"
+	"cloud_distributed_storage/Backend/store"
+	"cloud_distributed_storage/Backend/store/replica"
+	"cloud_distributed_storage/Backend/util"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
-	"os"
+	"strings"
 )
 
-// Transfer : 处理文件转移
-func Transfer(msg []byte) bool {
+// Transfer : 处理文件转移, 并在tbl_transfer_job中记录任务状态
+// 返回的错误经mq.Permanent包装时不再重试, 其余错误由消费者按退避策略重试
+// 等待重试期间任务保持排队状态并记录最近一次的失败原因, 重试耗尽或永久失败后才标记为失败
+func Transfer(msg []byte, retries int) error {
 	log.Println(string(msg))
 
 	pubData := mq.TransferData{}
 	err := json.Unmarshal(msg, &pubData)
 	if err != nil {
-		log.Println(err.Error())
-		return false
+		return mq.Permanent(err)
 	}
 
-	fin, err := os.Open(pubData.CurLocation)
+	updateJob(pubData.JobID, common.TransferRunning, "")
+	if err = transfer(context.Background(), pubData); err != nil {
+		status := common.TransferQueued
+		if mq.IsPermanent(err) || mq.LastAttempt(retries) {
+			status = common.TransferFailed
+		}
+		updateJob(pubData.JobID, status, err.Error())
+		return err
+	}
+	updateJob(pubData.JobID, common.TransferSucceeded, "")
+	return nil
+}
+
+// updateJob : 更新转移任务状态, 失败只记录日志
+func updateJob(jobID int64, status common.TransferStatus, lastError string) {
+	if jobID == 0 {
+		return
+	}
+	resp, err := dbcli.UpdateTransferJob(jobID, status, lastError)
+	if err != nil || resp == nil || !resp.Suc {
+		log.Printf("failed to update transfer job %d: %v\n", jobID, err)
+	}
+}
+
+func transfer(ctx context.Context, pubData mq.TransferData) error {
+	src, err := store.ByLocation(pubData.CurLocation)
 	if err != nil {
-		log.Println(err.Error())
-		return false
+		return mq.Permanent(err)
+	}
+	dest, err := store.Get(pubData.DestStoreType)
+	if err != nil {
+		return mq.Permanent(err)
 	}
 
-	s3Client := s3.GetS3Client()
-	bucketBasics := s3.BucketBasics{S3Client: s3Client}
-	err = bucketBasics.UploadFile(
-		cfg.S3_BUCKET_NAME,
-		pubData.DestLocation,
-		bufio.NewReader(fin))
+	srcInfo, err := src.Stat(ctx, pubData.CurLocation)
+	if errors.Is(err, store.ErrNotFound) {
+		return mq.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	fin, err := src.Get(ctx, pubData.CurLocation)
 	if err != nil {
-		log.Println(err.Error())
-		return false
+		return err
+	}
+	err = dest.Put(ctx, pubData.DestLocation, fin, srcInfo.Size)
+	fin.Close()
+	if err != nil {
+		return err
+	}
+
+	// 校验目标对象的大小及sha1, 确认无误后才能删除本地副本
+	if err = verifyRemote(ctx, dest, pubData.DestLocation, srcInfo.Size, pubData.FileHash); err != nil {
+		return err
+	}
+
+	// 副本转移只记录新位置, 源文件仍是主位置
+	if pubData.Replica {
+		return replica.Add(pubData.FileHash, pubData.DestLocation)
 	}
 
 	resp, err := dbcli.UpdateFileLocation(
 		pubData.FileHash,
 		pubData.DestLocation)
 	if err != nil {
-		log.Println(err.Error())
-		return false
+		return err
 	}
 	if !resp.Suc {
-		log.Println("更新数据库异常，请检查:" + pubData.FileHash)
-		return false
+		return fmt.Errorf("更新数据库异常，请检查: %s", pubData.FileHash)
+	}
+
+	// 文件已迁移到目标存储, 删除本地临时文件或迁移前的对象
+	if t, _ := store.Locate(pubData.CurLocation); t == common.StoreLocal || pubData.Move {
+		if err = src.Delete(ctx, pubData.CurLocation); err != nil {
+			log.Printf("failed to remove source copy %s: %v\n", pubData.CurLocation, err)
+		}
+	}
+	return nil
+}
+
+// verifyRemote : 读回远端对象, 校验大小及sha1
+func verifyRemote(ctx context.Context, st store.Store, key string, size int64, filehash string) error {
+	info, err := st.Stat(ctx, key)
+	if err != nil {
+		return err
+	}
+	if info.Size != size {
+		return fmt.Errorf("remote object %s size mismatch, expect %d got %d", key, size, info.Size)
+	}
+
+	rd, err := st.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	sha1Stream := &util.Sha1Stream{}
+	if _, err = io.Copy(sha1Stream, rd); err != nil {
+		return err
+	}
+	if !strings.EqualFold(sha1Stream.Sum(), filehash) {
+		return fmt.Errorf("remote object %s sha1 mismatch, expect %s got %s", key, filehash, sha1Stream.Sum())
 	}
-	return true
+	return nil
 }
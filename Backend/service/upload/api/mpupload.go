@@ -5,14 +5,14 @@ import (
 	"cloud_distributed_storage/Backend/common"
 	"cloud_distributed_storage/Backend/config"
 	cfg "cloud_distributed_storage/Backend/config"
-	"cloud_distributed_storage/Backend/mq"
 	dbcli "cloud_distributed_storage/Backend/service/dbproxy/client"
-	minio "cloud_distributed_storage/Backend/store/minio"
+	"cloud_distributed_storage/Backend/store"
+	"cloud_distributed_storage/Backend/store/policy"
 	"cloud_distributed_storage/Backend/util"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"math"
 	"net/http"
@@ -20,9 +20,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
-	"time"
 
-	"github.com/garyburd/redigo/redis"
 	"github.com/gin-gonic/gin"
 )
 
@@ -35,10 +33,44 @@ type MultipartUploadInfo struct {
 	ChunkCount int
 }
 
+// defaultChunkSize : 客户端未指定时的默认分块大小
+const defaultChunkSize = 5 * 1024 * 1024 // 5MB
+
+var (
+	errChunkSizeInvalid  = errors.New("chunk size invalid")
+	errChunkHashMismatch = errors.New("chunk sha1 mismatch")
+	errFileHashMismatch  = errors.New("file sha1 mismatch")
+)
+
 func init() {
 	os.MkdirAll(config.TempPartRootDir, 0744)
 }
 
+// optimalChunkSize : 根据文件大小及客户端期望的分块大小(<=0表示未指定)确定分块大小
+// 分块大小限制在[MultipartMinChunkSize, MultipartMaxChunkSize]之间, 分块数过多时按MB向上调大分块
+func optimalChunkSize(fileSize, requested int64) (int64, error) {
+	chunkSize := requested
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	if chunkSize < cfg.MultipartMinChunkSize {
+		chunkSize = cfg.MultipartMinChunkSize
+	}
+	if chunkSize > cfg.MultipartMaxChunkSize {
+		chunkSize = cfg.MultipartMaxChunkSize
+	}
+
+	maxParts := int64(cfg.MultipartMaxParts)
+	if (fileSize+chunkSize-1)/chunkSize > maxParts {
+		const mb = 1024 * 1024
+		chunkSize = ((fileSize+maxParts-1)/maxParts + mb - 1) / mb * mb
+		if chunkSize > cfg.MultipartMaxChunkSize {
+			return 0, fmt.Errorf("file size %d exceeds the multipart upload limit", fileSize)
+		}
+	}
+	return chunkSize, nil
+}
+
 // InitialMultipartUploadHandler : 初始化分块上传
 func InitialMultipartUploadHandler(c *gin.Context) {
 	// 1. 解析用户请求参数
@@ -54,26 +86,78 @@ func InitialMultipartUploadHandler(c *gin.Context) {
 			})
 		return
 	}
+	// 客户端可通过chunksize指定期望的分块大小, 由服务端在允许范围内调整
+	reqChunkSize, _ := strconv.ParseInt(c.Request.FormValue("chunksize"), 10, 64)
+	chunkSize, err := optimalChunkSize(int64(filesize), reqChunkSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error(), "data": nil})
+		return
+	}
 
 	// 2. 获得redis的一个连接
 	rConn := rPool.RedisPool().Get()
 	defer rConn.Close()
 
 	// 3. 生成分块上传的初始化信息
+	uploadID, err := newUploadID()
+	if err != nil {
+		log.Println(err.Error())
+		c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "服务错误", "data": nil})
+		return
+	}
 	upInfo := MultipartUploadInfo{
 		FileHash:   filehash,
 		FileSize:   filesize,
-		UploadID:   username + fmt.Sprintf("%x", time.Now().UnixNano()),
-		ChunkSize:  5 * 1024 * 1024, // 5MB
-		ChunkCount: int(math.Ceil(float64(filesize) / (5 * 1024 * 1024))),
+		UploadID:   uploadID,
+		ChunkSize:  int(chunkSize),
+		ChunkCount: int(math.Ceil(float64(filesize) / float64(chunkSize))),
+	}
+	fields := []interface{}{sessionKey(upInfo.UploadID),
+		"chunksize", upInfo.ChunkSize,
+		"chunkcount", upInfo.ChunkCount,
+		"filehash", upInfo.FileHash,
+		"filesize", upInfo.FileSize,
+		"username", username}
+
+	// 4. 按放置策略选定存储; 初始化时未提供文件名的普通分块上传在合并时再决策
+	filename := c.Request.FormValue("filename")
+	placement := placementOf(c.Request.Form, username, filename, int64(filesize))
+	primary, _ := policy.Targets(placement)
+	direct := cfg.MultipartDirectEnable && !cfg.ChunkDedupEnable && primary != common.StoreLocal
+	if filename != "" || direct {
+		fields = append(fields, "placement", int(placement))
+	}
+
+	// 5. 开启分块直传时在主存储的暂存位置创建分块上传, 分块不再落本地磁盘
+	if direct {
+		sess := &mpSession{StoreType: primary, ObjectKey: stagingKey(primary, upInfo.UploadID)}
+		mst, err := sess.backend()
+		if err == nil {
+			sess.BackendUploadID, err = mst.InitMultipart(c.Request.Context(), sess.ObjectKey)
+		}
+		if err != nil {
+			log.Println(err.Error())
+			c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "服务错误", "data": nil})
+			return
+		}
+		fields = append(fields,
+			"storetype", int(sess.StoreType),
+			"objkey", sess.ObjectKey,
+			"backendid", sess.BackendUploadID)
 	}
 
-	// 4. 将初始化信息写入到redis缓存
-	rConn.Do("HSET", "MP_"+upInfo.UploadID, "chunkcount", upInfo.ChunkCount)
-	rConn.Do("HSET", "MP_"+upInfo.UploadID, "filehash", upInfo.FileHash)
-	rConn.Do("HSET", "MP_"+upInfo.UploadID, "filesize", upInfo.FileSize)
+	// 6. 将初始化信息写入到redis缓存
+	_, err = rConn.Do("HMSET", fields...)
+	if err == nil {
+		err = touchSession(rConn, upInfo.UploadID)
+	}
+	if err != nil {
+		log.Println(err.Error())
+		c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "服务错误", "data": nil})
+		return
+	}
 
-	// 5. 将响应初始化数据返回到客户端
+	// 7. 将响应初始化数据返回到客户端
 	c.JSON(
 		http.StatusOK,
 		gin.H{
@@ -84,43 +168,68 @@ func InitialMultipartUploadHandler(c *gin.Context) {
 }
 
 // UploadPartHandler : 上传文件分块
+// 请求体为分块内容, chkhash为分块的sha1, 服务端校验通过后才记录该分块
 func UploadPartHandler(c *gin.Context) {
 	// 1. 解析用户请求参数
-	//	username := c.Request.FormValue("username")
+	username := c.Request.FormValue("username")
 	uploadID := c.Request.FormValue("uploadid")
-	chunkIndex := c.Request.FormValue("index")
+	chunkIndex, err := strconv.Atoi(c.Request.FormValue("index"))
+	chunkHash := strings.ToLower(c.Request.FormValue("chkhash"))
+	if err != nil || len(chunkHash) == 0 {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "params invalid", "data": nil})
+		return
+	}
 
-	// 2. 获得redis连接池中的一个连接
+	// 2. 获得redis连接池中的一个连接, 并校验分块序号
 	rConn := rPool.RedisPool().Get()
 	defer rConn.Close()
 
-	// 3. 获得文件句柄，用于存储分块内容
-	fpath := config.TempPartRootDir + uploadID + "/" + chunkIndex
-	os.MkdirAll(path.Dir(fpath), 0744)
-	fd, err := os.Create(fpath)
+	sess, err := loadSession(rConn, uploadID)
+	if err == nil && sess.UserName != username {
+		err = errSessionNotFound
+	}
 	if err != nil {
-		c.JSON(
-			http.StatusOK,
-			gin.H{
-				"code": 0,
-				"msg":  "Upload part failed",
-				"data": nil,
-			})
+		log.Println(err.Error())
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "上传会话不存在", "data": nil})
+		return
+	}
+	if chunkIndex < 1 || chunkIndex > sess.ChunkCount {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "分块序号无效", "data": nil})
 		return
 	}
-	defer fd.Close()
 
-	buf := make([]byte, 1024*1024)
-	for {
-		n, err := c.Request.Body.Read(buf)
-		fd.Write(buf[:n])
-		if err != nil {
-			break
-		}
+	// 3. 校验分块内容, 写入本地分块目录或直接上传到后端存储
+	fields := []interface{}{sessionKey(uploadID), "chkidx_" + strconv.Itoa(chunkIndex), chunkHash}
+	if sess.direct() {
+		var etag string
+		etag, err = uploadBackendPart(c.Request.Context(), sess, chunkIndex, chunkHash, c.Request.Body)
+		fields = append(fields, "etag_"+strconv.Itoa(chunkIndex), etag)
+	} else {
+		err = saveLocalPart(uploadID, chunkIndex, sess.partSize(chunkIndex), chunkHash, c.Request.Body)
+	}
+	if err == errChunkSizeInvalid {
+		c.JSON(http.StatusOK, gin.H{"code": -4, "msg": "分块大小与约定不符", "data": nil})
+		return
+	}
+	if err == errChunkHashMismatch {
+		c.JSON(http.StatusOK, gin.H{"code": -3, "msg": "分块校验失败", "data": nil})
+		return
+	}
+	if err != nil {
+		log.Println(err.Error())
+		c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "Upload part failed", "data": nil})
+		return
 	}
 
-	// 4. 更新redis缓存状态
-	rConn.Do("HSET", "MP_"+uploadID, "chkidx_"+chunkIndex, 1)
+	// 4. 更新redis缓存状态, 记录分块的sha1
+	if _, err = rConn.Do("HMSET", fields...); err == nil {
+		err = touchSession(rConn, uploadID)
+	}
+	if err != nil {
+		log.Println(err.Error())
+		c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "Upload part failed", "data": nil})
+		return
+	}
 
 	// 5. 返回处理结果到客户端
 	c.JSON(
@@ -132,13 +241,73 @@ func UploadPartHandler(c *gin.Context) {
 		})
 }
 
+// saveLocalPart : 先写入临时文件并计算sha1, 校验通过后再重命名, 避免留下不完整的分块
+// 分块大小必须等于size, 最多只读取size+1字节
+func saveLocalPart(uploadID string, chunkIndex int, size int64, chunkHash string, r io.Reader) error {
+	fpath := config.TempPartRootDir + uploadID + "/" + strconv.Itoa(chunkIndex)
+	os.MkdirAll(path.Dir(fpath), 0744)
+	fd, err := os.Create(fpath + ".tmp")
+	if err != nil {
+		return err
+	}
+	sha1Stream := &util.Sha1Stream{}
+	n, err := io.Copy(io.MultiWriter(fd, sha1Stream), io.LimitReader(r, size+1))
+	if closeErr := fd.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n != size {
+		err = errChunkSizeInvalid
+	}
+	if err == nil && sha1Stream.Sum() != chunkHash {
+		err = errChunkHashMismatch
+	}
+	if err != nil {
+		os.Remove(fpath + ".tmp")
+		return err
+	}
+	return os.Rename(fpath+".tmp", fpath)
+}
+
+// uploadBackendPart : 分块先写入本地临时文件并计算sha1, 校验通过后再上传到后端存储, 返回分块的ETag
+// 不在内存中缓存分块; 校验失败的分块不会上传, 客户端重传同一序号时后端会覆盖旧分块
+func uploadBackendPart(ctx context.Context, sess *mpSession, chunkIndex int, chunkHash string, r io.Reader) (string, error) {
+	size := sess.partSize(chunkIndex)
+	os.MkdirAll(config.TempPartRootDir, 0744)
+	fd, err := os.CreateTemp(config.TempPartRootDir, "part-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		fd.Close()
+		os.Remove(fd.Name())
+	}()
+
+	sha1Stream := &util.Sha1Stream{}
+	n, err := io.Copy(io.MultiWriter(fd, sha1Stream), io.LimitReader(r, size+1))
+	if err != nil {
+		return "", err
+	}
+	if n != size {
+		return "", errChunkSizeInvalid
+	}
+	if sha1Stream.Sum() != chunkHash {
+		return "", errChunkHashMismatch
+	}
+	if _, err = fd.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	mst, err := sess.backend()
+	if err != nil {
+		return "", err
+	}
+	return mst.UploadPart(ctx, sess.ObjectKey, sess.BackendUploadID, chunkIndex, fd, size)
+}
+
 // CompleteUploadHandler : 通知上传合并
 func CompleteUploadHandler(c *gin.Context) {
 	// 1. 解析请求参数
 	upid := c.Request.FormValue("uploadid")
 	username := c.Request.FormValue("username")
-	filehash := c.Request.FormValue("filehash")
-	filesize := c.Request.FormValue("filesize")
 	filename := c.Request.FormValue("filename")
 
 	// 2. 获得redis连接池中的一个连接
@@ -146,8 +315,12 @@ func CompleteUploadHandler(c *gin.Context) {
 	defer rConn.Close()
 
 	// 3. 通过uploadid查询redis并判断是否所有分块上传完成
-	data, err := redis.Values(rConn.Do("HGETALL", "MP_"+upid))
+	sess, err := loadSession(rConn, upid)
+	if err == nil && sess.UserName != username {
+		err = errSessionNotFound
+	}
 	if err != nil {
+		log.Println(err.Error())
 		c.JSON(
 			http.StatusOK,
 			gin.H{
@@ -157,129 +330,60 @@ func CompleteUploadHandler(c *gin.Context) {
 			})
 		return
 	}
-	totalCount := 0
-	chunkCount := 0
-	for i := 0; i < len(data); i += 2 {
-		k := string(data[i].([]byte))
-		v := string(data[i+1].([]byte))
-		if k == "chunkcount" {
-			totalCount, _ = strconv.Atoi(v)
-		} else if strings.HasPrefix(k, "chkidx_") && v == "1" {
-			chunkCount++
-		}
-	}
-	if totalCount != chunkCount {
+	if missing := sess.missing(); len(missing) > 0 {
 		c.JSON(
 			http.StatusOK,
 			gin.H{
 				"code": -2,
 				"msg":  "分块不完整",
-				"data": nil,
+				"data": gin.H{"missing": missing},
 			})
 		return
 	}
+	filehash := sess.FileHash
 
-	// 4. 合并分块
-	// 也可以不用在本地进行合并，转移的时候将分块append到ceph/s3即可
+	// 4. 合并分块, 同时计算整个文件的sha1, 与初始化时声明的filehash不一致则拒绝入库
 	srcPath := config.TempPartRootDir + upid + "/"
-	destPath := cfg.TempLocalRootDir + filehash
-	cmd := fmt.Sprintf("cd %s && ls | sort -n | xargs cat > %s", srcPath, destPath)
-	mergeRes, err := util.ExecLinuxShell(cmd)
-	if err != nil {
-		log.Println(err)
-		c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "合并失败", "data": nil})
-		return
-	}
-	log.Println(mergeRes)
-
-	// 5. 更新唯一文件表及用户文件表
-	fsize, _ := strconv.Atoi(filesize)
-
 	fmeta := dbcli.FileMeta{
 		FileSha1: filehash,
 		FileName: filename,
-		FileSize: int64(fsize),
-		Location: destPath,
-	}
-	_, ferr := dbcli.OnFileUploadFinished(fmeta)
-	_, uferr := dbcli.OnUserFileUploadFinished(username, fmeta)
-	if ferr != nil || uferr != nil {
-		log.Println(err)
-		c.JSON(
-			http.StatusOK,
-			gin.H{
-				"code": -2,
-				"msg":  "数据更新失败",
-				"data": nil,
-			})
-		return
+		FileSize: sess.FileSize,
 	}
-
-	// 6. 判断存储策略
-	var storageType string
-	if isImportantFile(fmeta) {
-		storageType = "minio"
-	} else {
-		storageType = "s3"
-	}
-
-	// 7. 根据存储策略保存文件
-	switch storageType {
-	case "minio":
-		// 保存文件到Minio
-		data, err := ioutil.ReadFile(destPath)
-		if err != nil {
-			log.Println(err.Error())
-			c.JSON(http.StatusInternalServerError, gin.H{"code": -3, "msg": "读取文件失败", "data": nil})
-			return
+	if sess.direct() {
+		// 分块已在后端存储, 由后端完成合并
+		fmeta.Location, err = completeBackendUpload(c.Request.Context(), sess)
+		if err == nil {
+			placeExtras(c.Request.Context(), sess.Placement, username, filehash, fmeta.Location)
 		}
-		minioPath := cfg.MinioRootDir + filehash
-		err = minio.PutObject("filestore", minioPath, data, "application/octet-stream")
-		if err != nil {
-			log.Println(err.Error())
-			c.JSON(http.StatusInternalServerError, gin.H{"code": -4, "msg": "上传到Minio失败", "data": nil})
-			return
-		}
-		fmeta.Location = minioPath
-	case "s3":
-		// 文件写入S3存储
-		// 判断写入S3为同步还是异步
-		if cfg.AsyncTransferEnable {
-			data := mq.TransferData{
-				FileHash:      filehash,
-				CurLocation:   destPath,
-				DestLocation:  cfg.S3RootDir + filehash,
-				DestStoreType: common.StoreS3,
-			}
-			pubData, _ := json.Marshal(data)
-			pubSuc := mq.Publish(
-				cfg.TransExchangeName,
-				cfg.TransS3RoutingKey,
-				pubData,
-			)
-			if !pubSuc {
-				log.Println("文件转移消息发送失败，稍后重试")
-			}
+	} else {
+		storeType := sess.Placement
+		if storeType == 0 {
+			storeType = placementOf(c.Request.Form, username, filename, sess.FileSize)
 		}
+		fmeta.Location, err = completeLocalUpload(c.Request.Context(), sess, srcPath, username, storeType)
+	}
+	if err == errFileHashMismatch {
+		c.JSON(http.StatusOK, gin.H{"code": -3, "msg": "文件校验失败", "data": nil})
+		return
 	}
-
-	// 8. 更新文件表记录
-	_, err = dbcli.OnFileUploadFinished(fmeta)
 	if err != nil {
 		log.Println(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"code": -5, "msg": "保存文件元信息失败", "data": nil})
+		c.JSON(http.StatusInternalServerError, gin.H{"code": -4, "msg": "写入存储失败", "data": nil})
 		return
 	}
 
-	// 9. 更新用户文件表记录
-	upRes, err := dbcli.OnUserFileUploadFinished(username, fmeta)
-	if err != nil || !upRes.Suc {
+	// 5. 在同一事务中更新文件表及用户文件表记录
+	if err = dbcli.OnUploadFinished(username, fmeta); err != nil {
 		log.Println(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"code": -6, "msg": "保存用户文件关系失败", "data": nil})
+		c.JSON(http.StatusInternalServerError, gin.H{"code": -6, "msg": "保存文件信息失败", "data": nil})
 		return
 	}
 
-	// 10. 响应处理结果
+	// 6. 清理分块及上传状态
+	os.RemoveAll(srcPath)
+	removeSession(rConn, upid)
+
+	// 7. 响应处理结果
 	c.JSON(http.StatusOK, gin.H{
 		"code": 0,
 		"msg":  "上传成功",
@@ -287,125 +391,154 @@ func CompleteUploadHandler(c *gin.Context) {
 	})
 }
 
-// CancelUploadHandler : 取消上传
-func CancelUploadHandler(c *gin.Context) {
-	uploadID := c.PostForm("uploadid")
-
-	rConn := rPool.RedisPool().Get()
-	defer rConn.Close()
-
-	// 删除文件分块
-	os.RemoveAll(config.TempPartRootDir + uploadID)
-
-	// 清除redis缓存
-	rConn.Do("DEL", "MP_"+uploadID)
+// completeLocalUpload : 在本地合并分块并校验, 再按存储策略写入目标存储, 返回file_addr
+func completeLocalUpload(ctx context.Context, sess *mpSession, srcPath, username string, storeType common.StoreType) (string, error) {
+	destPath := cfg.TempLocalRootDir + sess.FileHash
+	fileSha1, fileSize, err := mergeParts(srcPath, sess.ChunkCount, destPath)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(fileSha1, sess.FileHash) || fileSize != sess.FileSize {
+		log.Printf("merged file mismatch, expect %s(%d) got %s(%d)\n", sess.FileHash, sess.FileSize, fileSha1, fileSize)
+		os.Remove(destPath)
+		return "", errFileHashMismatch
+	}
 
-	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "OK", "data": nil})
+	return placeFile(ctx, storeType, username, sess.FileHash, destPath)
 }
 
-// MultipartUploadStatusHandler : 查询分块上传的状态
-func MultipartUploadStatusHandler(c *gin.Context) {
-	uploadID := c.PostForm("uploadid")
-
-	rConn := rPool.RedisPool().Get()
-	defer rConn.Close()
-
-	data, err := redis.Values(rConn.Do("HGETALL", "MP_"+uploadID))
+// completeBackendUpload : 通知后端将分块合并到暂存位置, 校验sha1后再移到最终位置, 返回file_addr
+func completeBackendUpload(ctx context.Context, sess *mpSession) (string, error) {
+	mst, err := sess.backend()
 	if err != nil {
-		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "查询失败", "data": nil})
-		return
+		return "", err
 	}
-
-	ret := make(map[string]interface{})
-	for i := 0; i < len(data); i += 2 {
-		k := string(data[i].([]byte))
-		v := string(data[i+1].([]byte))
-		ret[k] = v
+	if err = mst.CompleteMultipart(ctx, sess.ObjectKey, sess.BackendUploadID, sess.backendParts()); err != nil {
+		return "", err
 	}
-	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "OK", "data": ret})
+	return promoteObject(ctx, mst, sess)
 }
 
-// MultiDownloadHandler : 断点续传下载
-func MultiDownloadHandler(c *gin.Context) {
-	filehash := c.Query("filehash")
-	username := c.Query("username")
-
-	// 检查用户对文件的访问权限
-	permResult, err := dbcli.CheckPermission(username, filehash)
-	if err != nil || !permResult.Suc {
-		c.JSON(http.StatusForbidden, gin.H{"code": -1, "msg": "Permission denied", "data": nil})
-		return
+// promoteObject : 校验暂存对象后复制到以filehash命名的最终位置并删除暂存对象, 返回file_addr
+// 最终位置可能已被其他用户的同一文件引用, 只有内容与filehash一致的对象才会写入
+func promoteObject(ctx context.Context, st store.Store, sess *mpSession) (string, error) {
+	if !sess.isStaging() {
+		return "", fmt.Errorf("upload %s: object %s is not a staging key", sess.UploadID, sess.ObjectKey)
+	}
+	if err := verifyObject(ctx, st, sess); err != nil {
+		return "", err
+	}
+	dst := sess.finalKey()
+	if err := st.Copy(ctx, sess.ObjectKey, dst); err != nil {
+		return "", err
 	}
+	if err := st.Delete(ctx, sess.ObjectKey); err != nil {
+		log.Printf("failed to delete staging object %s: %v\n", sess.ObjectKey, err)
+	}
+	return dst, nil
+}
 
-	fmetaResult, err := dbcli.GetFileMeta(filehash)
-	if err != nil || !fmetaResult.Suc {
-		c.JSON(http.StatusNotFound, gin.H{"code": -1, "msg": "File not found", "data": nil})
-		return
+// verifyObject : 读回暂存对象校验大小及sha1, 不一致时删除该暂存对象
+func verifyObject(ctx context.Context, st store.Store, sess *mpSession) error {
+	// 先比较大小, 大小不符时无需读取内容
+	info, err := st.Stat(ctx, sess.ObjectKey)
+	if err != nil {
+		return err
+	}
+	if info.Size != sess.FileSize {
+		log.Printf("object %s size mismatch, expect %d got %d\n", sess.ObjectKey, sess.FileSize, info.Size)
+		st.Delete(ctx, sess.ObjectKey)
+		return errFileHashMismatch
 	}
 
-	fmeta := dbcli.ToTableFile(fmetaResult.Data)
+	rd, err := st.Get(ctx, sess.ObjectKey)
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+	sha1Stream := &util.Sha1Stream{}
+	fileSize, err := io.Copy(sha1Stream, rd)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sha1Stream.Sum(), sess.FileHash) || fileSize != sess.FileSize {
+		log.Printf("object %s mismatch, expect %s(%d) got %s(%d)\n",
+			sess.ObjectKey, sess.FileHash, sess.FileSize, sha1Stream.Sum(), fileSize)
+		st.Delete(ctx, sess.ObjectKey)
+		return errFileHashMismatch
+	}
+	return nil
+}
 
-	f, err := os.Open(fmeta.FileAddr.String)
+// mergeParts : 按序号将分块合并为一个文件, 返回合并后文件的sha1及大小
+func mergeParts(srcPath string, chunkCount int, destPath string) (string, int64, error) {
+	dest, err := os.Create(destPath)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": -1, "msg": "File cannot be opened", "data": nil})
-		return
+		return "", 0, err
 	}
-	defer f.Close()
+	defer dest.Close()
 
-	fileSize := fmeta.FileSize.Int64
-	fileName := fmeta.FileName.String
+	sha1Stream := &util.Sha1Stream{}
+	w := io.MultiWriter(dest, sha1Stream)
+	var size int64
+	for idx := 1; idx <= chunkCount; idx++ {
+		part, err := os.Open(srcPath + strconv.Itoa(idx))
+		if err != nil {
+			return "", 0, err
+		}
+		n, err := io.Copy(w, part)
+		part.Close()
+		if err != nil {
+			return "", 0, err
+		}
+		size += n
+	}
+	return sha1Stream.Sum(), size, dest.Close()
+}
 
-	c.Header("Content-Type", "application/octet-stream")
-	c.Header("Content-Disposition", "attachment; filename="+fileName)
-	c.Header("Accept-Ranges", "bytes")
+// CancelUploadHandler : 取消上传
+// 只有会话的发起用户可以取消
+func CancelUploadHandler(c *gin.Context) {
+	uploadID := c.PostForm("uploadid")
+	username := c.Request.FormValue("username")
 
-	rangeHeader := c.GetHeader("Range")
-	if rangeHeader != "" {
-		var start, end int64
-		_, err := fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end)
-		if err != nil && err != io.EOF {
-			c.JSON(http.StatusBadRequest, gin.H{"code": -1, "msg": "Invalid range header", "data": nil})
-			return
-		}
+	rConn := rPool.RedisPool().Get()
+	defer rConn.Close()
 
-		if end == 0 {
-			end = fileSize - 1
-		}
+	sess, err := loadSession(rConn, uploadID)
+	if err != nil || sess.UserName != username {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "上传会话不存在", "data": nil})
+		return
+	}
 
-		if start > end || start < 0 || end >= fileSize {
-			c.Header("Content-Range", fmt.Sprintf("bytes */%d", fileSize))
-			c.Status(http.StatusRequestedRangeNotSatisfiable)
-			return
-		}
+	// 删除文件分块及redis缓存, 分块直传时取消后端的分块上传
+	releaseSession(c.Request.Context(), rConn, uploadID)
 
-		c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, fileSize))
-		c.Header("Content-Length", strconv.FormatInt(end-start+1, 10))
-		c.Status(http.StatusPartialContent)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "OK", "data": nil})
+}
 
-		_, err = f.Seek(start, 0)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"code": -1, "msg": "Failed to seek file", "data": nil})
-			return
-		}
+// MultipartUploadStatusHandler : 查询分块上传的状态
+// 返回已上传及缺失的分块序号, 客户端中断后据此只补传缺失的分块
+func MultipartUploadStatusHandler(c *gin.Context) {
+	uploadID := c.PostForm("uploadid")
+	username := c.Request.FormValue("username")
 
-		_, err = io.CopyN(c.Writer, f, end-start+1)
-		if err != nil && err != io.EOF {
-			c.JSON(http.StatusInternalServerError, gin.H{"code": -1, "msg": "Failed to copy file content", "data": nil})
-			return
-		}
-	} else {
-		c.Header("Content-Length", strconv.FormatInt(fileSize, 10))
-		_, err = io.Copy(c.Writer, f)
-		if err != nil && err != io.EOF {
-			c.JSON(http.StatusInternalServerError, gin.H{"code": -1, "msg": "Failed to copy file content", "data": nil})
-			return
-		}
-	}
+	rConn := rPool.RedisPool().Get()
+	defer rConn.Close()
 
-	// 更新下载次数等信息
-	_, err = dbcli.UpdateUserFileDownloadCount(username, filehash)
-	if err != nil {
-		// 仅记录日志，不影响下载
-		log.Printf("Failed to update download count: %v", err)
+	sess, err := loadSession(rConn, uploadID)
+	if err != nil || sess.UserName != username {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "查询失败", "data": nil})
+		return
 	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "OK", "data": gin.H{
+		"uploadid":   sess.UploadID,
+		"filehash":   sess.FileHash,
+		"filesize":   sess.FileSize,
+		"chunksize":  sess.ChunkSize,
+		"chunkcount": sess.ChunkCount,
+		"uploaded":   sess.uploaded(),
+		"missing":    sess.missing(),
+	}})
 }
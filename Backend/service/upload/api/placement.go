@@ -0,0 +1,126 @@
+package api
+
+import (
+	"cloud_distributed_storage/Backend/common"
+	cfg "cloud_distributed_storage/Backend/config"
+	"cloud_distributed_storage/Backend/mq"
+	dbcli "cloud_distributed_storage/Backend/service/dbproxy/client"
+	"cloud_distributed_storage/Backend/store"
+	"cloud_distributed_storage/Backend/store/policy"
+	"cloud_distributed_storage/Backend/store/replica"
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// placementOf : 按放置策略为文件选择存储类型, 普通上传与分块上传统一在此决策
+// form为请求的表单参数, 其中可选的mimetype、tags(逗号分隔)参数参与规则匹配
+func placementOf(form url.Values, username, filename string, size int64) common.StoreType {
+	p := policy.Default()
+	f := policy.FileInfo{
+		Name:  filename,
+		Size:  size,
+		MIME:  form.Get("mimetype"),
+		Owner: username,
+		Tags:  splitTags(form.Get("tags")),
+	}
+	if p.UsesRoles() {
+		f.Roles = userRoles(username)
+	}
+	return p.Place(f)
+}
+
+func splitTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// userRoles : 查询用户的角色名, 查询失败时按无角色处理
+func userRoles(username string) []string {
+	resp, err := dbcli.GetUserRoles(username)
+	if err != nil || resp == nil || !resp.Suc {
+		log.Printf("failed to get roles of %s: %v\n", username, err)
+		return nil
+	}
+	roles := make([]string, 0, len(resp.Data))
+	for _, role := range resp.Data {
+		roles = append(roles, role.RoleName)
+	}
+	return roles
+}
+
+// copyTo : 将src处的文件同步写入storeType对应的存储, 返回新的存储地址
+func copyTo(ctx context.Context, storeType common.StoreType, filehash, src string) (string, error) {
+	srcStore, err := store.ByLocation(src)
+	if err != nil {
+		return "", err
+	}
+	dstStore, err := store.Get(storeType)
+	if err != nil {
+		return "", err
+	}
+	info, err := srcStore.Stat(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	rd, err := srcStore.Get(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	defer rd.Close()
+
+	destPath := store.Addr(storeType, filehash)
+	if err = dstStore.Put(ctx, destPath, rd, info.Size); err != nil {
+		return "", err
+	}
+	return destPath, nil
+}
+
+// publishTransfer : 投递异步转移任务, 由transfer服务将src处的文件写入storeType对应的存储
+// asReplica为true时目标位置作为副本保存, file_addr仍指向src
+func publishTransfer(username, filehash, src string, storeType common.StoreType, asReplica bool) {
+	destPath := store.Addr(storeType, filehash)
+	data := mq.TransferData{
+		FileHash:      filehash,
+		CurLocation:   src,
+		DestLocation:  destPath,
+		DestStoreType: storeType,
+		UserName:      username,
+		JobID:         createTransferJob(username, filehash, src, destPath, storeType),
+		Replica:       asReplica,
+	}
+	pubData, _ := json.Marshal(data)
+	log.Printf("start to publish message to transcode: %s\n", pubData)
+	if !mq.Publish(cfg.TransExchangeName, cfg.TransS3RoutingKey, pubData) {
+		log.Println("文件转移消息发送失败，稍后重试")
+	}
+}
+
+// placeExtras : StoreMix/StoreAll在主存储之外再向其他存储各保存一份副本
+// StoreAll同步写入, 失败时退回异步转移; StoreMix直接为每个存储投递一个副本转移任务
+func placeExtras(ctx context.Context, storeType common.StoreType, username, filehash, src string) {
+	_, extras := policy.Targets(storeType)
+	for _, t := range extras {
+		if storeType == common.StoreAll || !cfg.AsyncTransferEnable {
+			addr, err := copyTo(ctx, t, filehash, src)
+			if err == nil {
+				err = replica.Add(filehash, addr)
+			}
+			if err == nil {
+				continue
+			}
+			log.Printf("failed to copy %s to store %d: %v\n", filehash, t, err)
+			if !cfg.AsyncTransferEnable {
+				continue
+			}
+		}
+		publishTransfer(username, filehash, src, t, true)
+	}
+}
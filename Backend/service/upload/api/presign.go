@@ -0,0 +1,261 @@
+package api
+
+import (
+	rPool "cloud_distributed_storage/Backend/cache/redis"
+	cfg "cloud_distributed_storage/Backend/config"
+	dbcli "cloud_distributed_storage/Backend/service/dbproxy/client"
+	"cloud_distributed_storage/Backend/store"
+	"cloud_distributed_storage/Backend/store/policy"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// presignPart : 客户端确认上传时提交的分块信息, etag为存储返回的ETag响应头
+type presignPart struct {
+	Index int    `json:"index"`
+	ETag  string `json:"etag"`
+}
+
+// presigner : 获取会话对应存储的预签名能力
+func presigner(sess *mpSession) (store.Presigner, error) {
+	st, err := store.Get(sess.StoreType)
+	if err != nil {
+		return nil, err
+	}
+	ps, ok := st.(store.Presigner)
+	if !ok {
+		return nil, fmt.Errorf("store type %d does not support presigned url", sess.StoreType)
+	}
+	return ps, nil
+}
+
+// PresignInitHandler : 初始化预签名直传
+// 文件不超过一个分块时直接返回整个对象的PUT地址, 否则在存储中创建分块上传, 由客户端逐个获取分块地址
+func PresignInitHandler(c *gin.Context) {
+	// 1. 解析用户请求参数
+	username := c.Request.FormValue("username")
+	filehash := c.Request.FormValue("filehash")
+	filename := c.Request.FormValue("filename")
+	filesize, err := strconv.ParseInt(c.Request.FormValue("filesize"), 10, 64)
+	if err != nil || filesize < 0 || len(filehash) == 0 {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "params invalid", "data": nil})
+		return
+	}
+	reqChunkSize, _ := strconv.ParseInt(c.Request.FormValue("chunksize"), 10, 64)
+	chunkSize, err := optimalChunkSize(filesize, reqChunkSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error(), "data": nil})
+		return
+	}
+
+	// 2. 按放置策略选择目标存储, 文件先写入主存储中该会话的暂存位置, 确认时校验后再移到最终位置
+	placement := placementOf(c.Request.Form, username, filename, filesize)
+	storeType, _ := policy.Targets(placement)
+	uploadID, err := newUploadID()
+	if err != nil {
+		log.Println(err.Error())
+		c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "服务错误", "data": nil})
+		return
+	}
+	sess := &mpSession{
+		UploadID:   uploadID,
+		FileHash:   filehash,
+		FileSize:   filesize,
+		ChunkSize:  chunkSize,
+		ChunkCount: int(math.Ceil(float64(filesize) / float64(chunkSize))),
+		UserName:   username,
+		Presigned:  true,
+		Placement:  placement,
+		StoreType:  storeType,
+		ObjectKey:  stagingKey(storeType, uploadID),
+	}
+	ps, err := presigner(sess)
+	if err != nil {
+		log.Println(err.Error())
+		c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "服务错误", "data": nil})
+		return
+	}
+
+	// 3. 生成上传地址
+	data := gin.H{
+		"uploadid":   sess.UploadID,
+		"chunksize":  chunkSize,
+		"chunkcount": sess.ChunkCount,
+		"multipart":  sess.ChunkCount > 1,
+	}
+	if sess.ChunkCount > 1 {
+		mst, err := sess.backend()
+		if err == nil {
+			sess.BackendUploadID, err = mst.InitMultipart(c.Request.Context(), sess.ObjectKey)
+		}
+		if err != nil {
+			log.Println(err.Error())
+			c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "服务错误", "data": nil})
+			return
+		}
+	} else {
+		url, err := ps.PresignPut(c.Request.Context(), sess.ObjectKey, cfg.PresignExpiry)
+		if err != nil {
+			log.Println(err.Error())
+			c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "服务错误", "data": nil})
+			return
+		}
+		data["url"] = url
+	}
+
+	// 4. 记录上传会话, 确认上传时据此校验对象
+	rConn := rPool.RedisPool().Get()
+	defer rConn.Close()
+	_, err = rConn.Do("HMSET", sessionKey(sess.UploadID),
+		"chunksize", sess.ChunkSize,
+		"chunkcount", sess.ChunkCount,
+		"filehash", sess.FileHash,
+		"filesize", sess.FileSize,
+		"username", sess.UserName,
+		"presign", 1,
+		"placement", int(sess.Placement),
+		"storetype", int(sess.StoreType),
+		"objkey", sess.ObjectKey,
+		"backendid", sess.BackendUploadID)
+	if err == nil {
+		err = touchSession(rConn, sess.UploadID)
+	}
+	if err != nil {
+		log.Println(err.Error())
+		c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "服务错误", "data": nil})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "OK", "data": data})
+}
+
+// PresignPartHandler : 获取分块的预签名上传地址
+func PresignPartHandler(c *gin.Context) {
+	uploadID := c.Request.FormValue("uploadid")
+	username := c.Request.FormValue("username")
+	chunkIndex, err := strconv.Atoi(c.Request.FormValue("index"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "params invalid", "data": nil})
+		return
+	}
+
+	rConn := rPool.RedisPool().Get()
+	defer rConn.Close()
+
+	sess, err := loadSession(rConn, uploadID)
+	if err != nil || !sess.Presigned || !sess.direct() || sess.UserName != username {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "上传会话不存在", "data": nil})
+		return
+	}
+	if chunkIndex < 1 || chunkIndex > sess.ChunkCount {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "分块序号无效", "data": nil})
+		return
+	}
+
+	ps, err := presigner(sess)
+	var url string
+	if err == nil {
+		url, err = ps.PresignPart(c.Request.Context(), sess.ObjectKey, sess.BackendUploadID, chunkIndex, cfg.PresignExpiry)
+	}
+	if err == nil {
+		err = touchSession(rConn, uploadID)
+	}
+	if err != nil {
+		log.Println(err.Error())
+		c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "服务错误", "data": nil})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "OK", "data": gin.H{"index": chunkIndex, "url": url}})
+}
+
+// PresignConfirmHandler : 确认预签名直传完成
+// 校验对象存在且大小、sha1与声明一致后再写入文件表及用户文件表
+func PresignConfirmHandler(c *gin.Context) {
+	// 1. 解析请求参数
+	uploadID := c.Request.FormValue("uploadid")
+	username := c.Request.FormValue("username")
+	filename := c.Request.FormValue("filename")
+
+	rConn := rPool.RedisPool().Get()
+	defer rConn.Close()
+
+	sess, err := loadSession(rConn, uploadID)
+	if err != nil || !sess.Presigned || sess.UserName != username {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "上传会话不存在", "data": nil})
+		return
+	}
+	st, err := store.Get(sess.StoreType)
+	if err != nil {
+		log.Println(err.Error())
+		c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "服务错误", "data": nil})
+		return
+	}
+
+	// 2. 分块上传需由存储合并分块, 分块的ETag由客户端从存储的响应中获得
+	if sess.direct() {
+		var parts []presignPart
+		if err := json.Unmarshal([]byte(c.Request.FormValue("parts")), &parts); err != nil {
+			c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "params invalid", "data": nil})
+			return
+		}
+		for _, p := range parts {
+			if p.Index < 1 || p.Index > sess.ChunkCount || p.ETag == "" {
+				c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "分块序号无效", "data": nil})
+				return
+			}
+			sess.ETags[p.Index] = p.ETag
+		}
+		if len(sess.ETags) != sess.ChunkCount {
+			c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "分块不完整", "data": nil})
+			return
+		}
+		mst, err := sess.backend()
+		if err == nil {
+			err = mst.CompleteMultipart(c.Request.Context(), sess.ObjectKey, sess.BackendUploadID, sess.backendParts())
+		}
+		if err != nil {
+			log.Println(err.Error())
+			c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "合并分块失败", "data": nil})
+			return
+		}
+	}
+
+	// 3. 校验暂存对象的大小及sha1, 通过后移到最终位置
+	location, err := promoteObject(c.Request.Context(), st, sess)
+	if err == errFileHashMismatch {
+		removeSession(rConn, uploadID)
+		c.JSON(http.StatusOK, gin.H{"code": -3, "msg": "文件校验失败", "data": nil})
+		return
+	}
+	if err != nil {
+		log.Println(err.Error())
+		c.JSON(http.StatusOK, gin.H{"code": -3, "msg": "文件不存在", "data": nil})
+		return
+	}
+	placeExtras(c.Request.Context(), sess.Placement, sess.UserName, sess.FileHash, location)
+
+	// 4. 更新文件表及用户文件表记录
+	fmeta := dbcli.FileMeta{
+		FileSha1: sess.FileHash,
+		FileName: filename,
+		FileSize: sess.FileSize,
+		Location: location,
+	}
+	if err = dbcli.OnUploadFinished(username, fmeta); err != nil {
+		log.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"code": -6, "msg": "保存文件信息失败", "data": nil})
+		return
+	}
+
+	// 5. 清除上传会话
+	removeSession(rConn, uploadID)
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "上传成功", "data": nil})
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	rPool "cloud_distributed_storage/Backend/cache/redis"
+	cfg "cloud_distributed_storage/Backend/config"
+	"cloud_distributed_storage/Backend/store"
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// 过期会话清理的统计信息, 通过/debug/vars查看
+var (
+	reapedSessions  = expvar.NewInt("upload_reaped_sessions")
+	reapedBytes     = expvar.NewInt("upload_reaped_part_bytes")
+	abortedBackends = expvar.NewInt("upload_aborted_backend_uploads")
+	orphanDirs      = expvar.NewInt("upload_reaped_orphan_dirs")
+)
+
+// StartSessionReaper : 启动后台协程, 周期性清理过期的分块/预签名上传会话
+func StartSessionReaper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			reapSessions(context.Background())
+		}
+	}()
+}
+
+// reapSessions : 清理已过期的会话, 以及没有对应会话的分块目录
+func reapSessions(ctx context.Context) {
+	rConn := rPool.RedisPool().Get()
+	defer rConn.Close()
+
+	now := time.Now()
+	ids, err := redis.Strings(rConn.Do("ZRANGEBYSCORE", sessionIndexKey, "-inf", now.Unix()))
+	if err != nil {
+		log.Println("failed to load expired upload sessions: " + err.Error())
+		return
+	}
+	for _, id := range ids {
+		size, aborted := releaseSession(ctx, rConn, id)
+		reapedSessions.Add(1)
+		reapedBytes.Add(size)
+		if aborted {
+			abortedBackends.Add(1)
+		}
+	}
+	if len(ids) > 0 {
+		log.Printf("reaped %d expired upload sessions\n", len(ids))
+	}
+
+	// 会话已不存在(如redis数据丢失)但长时间未更新的分块目录
+	dirs, err := os.ReadDir(cfg.TempPartRootDir)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	for _, dir := range dirs {
+		info, err := dir.Info()
+		if err != nil || !dir.IsDir() || now.Sub(info.ModTime()) < cfg.UploadSessionTTL {
+			continue
+		}
+		if _, err := redis.Int64(rConn.Do("ZSCORE", sessionIndexKey, dir.Name())); err != redis.ErrNil {
+			continue
+		}
+		reapedBytes.Add(removePartDir(dir.Name()))
+		orphanDirs.Add(1)
+	}
+}
+
+// releaseSession : 删除会话的本地分块、后端分块上传及redis状态
+// 返回释放的本地分块字节数, 以及是否取消了后端的分块上传
+func releaseSession(ctx context.Context, rConn redis.Conn, uploadID string) (size int64, aborted bool) {
+	if sess, err := loadSession(rConn, uploadID); err == nil {
+		if sess.direct() {
+			mst, err := sess.backend()
+			if err == nil {
+				err = mst.AbortMultipart(ctx, sess.ObjectKey, sess.BackendUploadID)
+			}
+			if err != nil {
+				log.Printf("failed to abort multipart upload %s: %v\n", uploadID, err)
+			}
+			aborted = err == nil
+		}
+		// 已合并或已直接写入的暂存对象
+		if sess.isStaging() {
+			removeStaging(ctx, sess)
+		}
+	}
+	size = removePartDir(uploadID)
+	if err := removeSession(rConn, uploadID); err != nil {
+		log.Println(err.Error())
+	}
+	return size, aborted
+}
+
+// removeStaging : 删除会话的暂存对象, 对象不存在时忽略
+func removeStaging(ctx context.Context, sess *mpSession) {
+	st, err := store.Get(sess.StoreType)
+	if err == nil {
+		err = st.Delete(ctx, sess.ObjectKey)
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("failed to delete staging object %s: %v\n", sess.ObjectKey, err)
+	}
+}
+
+// removePartDir : 删除会话的本地分块目录, 返回释放的字节数
+func removePartDir(uploadID string) int64 {
+	if !validUploadID(uploadID) {
+		log.Printf("refuse to remove part dir of invalid upload id %q\n", uploadID)
+		return 0
+	}
+	dir := filepath.Join(cfg.TempPartRootDir, uploadID)
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err := os.RemoveAll(dir); err != nil {
+		log.Println(err.Error())
+		return 0
+	}
+	return size
+}
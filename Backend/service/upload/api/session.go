@@ -0,0 +1,216 @@
+package api
+
+import (
+	"cloud_distributed_storage/Backend/common"
+	cfg "cloud_distributed_storage/Backend/config"
+	"cloud_distributed_storage/Backend/store"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// errSessionNotFound : 分块上传会话不存在(未初始化、已完成或已取消)
+var errSessionNotFound = errors.New("multipart upload session not found")
+
+// mpSession : redis中MP_<uploadid>保存的分块上传状态
+type mpSession struct {
+	UploadID   string
+	FileHash   string
+	FileSize   int64
+	ChunkSize  int64
+	ChunkCount int
+	// Parts : 已上传分块的序号(从1开始)及其sha1
+	Parts map[int]string
+	// UserName : 上传的发起用户, 完成、取消及确认上传时校验
+	UserName string
+	// Presigned : 是否为预签名直传, 此时服务端不经手文件内容
+	Presigned bool
+	// Placement : 初始化时由放置策略选定的存储类型, 0表示尚未决策
+	Placement common.StoreType
+	// 以下字段仅在分块直接上传到S3/MinIO时有值
+	StoreType common.StoreType
+	// ObjectKey : 直传对象的暂存位置, 校验通过后才复制到finalKey
+	ObjectKey       string
+	BackendUploadID string
+	ETags           map[int]string
+}
+
+// sessionIndexKey : 记录所有上传会话过期时间的有序集合, 供过期清理使用
+const sessionIndexKey = "MP_SESSIONS"
+
+func sessionKey(uploadID string) string {
+	return "MP_" + uploadID
+}
+
+// touchSession : 顺延上传会话的过期时间
+// 过期时间记录在有序集合中, 由reaper负责清理本地分块及后端分块上传;
+// hash本身的TTL多留一个周期, 保证reaper清理时仍能读到会话内容
+func touchSession(rConn redis.Conn, uploadID string) error {
+	expireAt := time.Now().Add(cfg.UploadSessionTTL).Unix()
+	rConn.Send("MULTI")
+	rConn.Send("ZADD", sessionIndexKey, expireAt, uploadID)
+	rConn.Send("EXPIRE", sessionKey(uploadID), int64(2*cfg.UploadSessionTTL/time.Second))
+	_, err := rConn.Do("EXEC")
+	return err
+}
+
+// removeSession : 删除上传会话
+func removeSession(rConn redis.Conn, uploadID string) error {
+	rConn.Send("MULTI")
+	rConn.Send("DEL", sessionKey(uploadID))
+	rConn.Send("ZREM", sessionIndexKey, uploadID)
+	_, err := rConn.Do("EXEC")
+	return err
+}
+
+// newUploadID : 生成上传会话id, 只包含十六进制字符, 可直接用作分块目录名及对象名
+func newUploadID() (string, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x%s", time.Now().UnixNano(), hex.EncodeToString(nonce)), nil
+}
+
+// validUploadID : uploadID来自客户端, 用于拼接本地路径前必须是单独的一级目录名
+// 旧版本的id以用户名开头, 因此不限制字符集, 只排除空值及路径分隔符
+func validUploadID(uploadID string) bool {
+	return uploadID != "" && uploadID != "." && uploadID != ".." &&
+		!strings.ContainsAny(uploadID, `/\`) && len(uploadID) <= 256
+}
+
+// loadSession : 从redis读取分块上传状态
+func loadSession(rConn redis.Conn, uploadID string) (*mpSession, error) {
+	if !validUploadID(uploadID) {
+		return nil, errSessionNotFound
+	}
+	data, err := redis.StringMap(rConn.Do("HGETALL", sessionKey(uploadID)))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errSessionNotFound
+	}
+
+	sess := &mpSession{UploadID: uploadID, Parts: map[int]string{}, ETags: map[int]string{}}
+	for k, v := range data {
+		switch {
+		case k == "filehash":
+			sess.FileHash = v
+		case k == "filesize":
+			sess.FileSize, _ = strconv.ParseInt(v, 10, 64)
+		case k == "chunksize":
+			sess.ChunkSize, _ = strconv.ParseInt(v, 10, 64)
+		case k == "chunkcount":
+			sess.ChunkCount, _ = strconv.Atoi(v)
+		case k == "storetype":
+			t, _ := strconv.Atoi(v)
+			sess.StoreType = common.StoreType(t)
+		case k == "placement":
+			t, _ := strconv.Atoi(v)
+			sess.Placement = common.StoreType(t)
+		case k == "username":
+			sess.UserName = v
+		case k == "presign":
+			sess.Presigned = v == "1"
+		case k == "objkey":
+			sess.ObjectKey = v
+		case k == "backendid":
+			sess.BackendUploadID = v
+		case strings.HasPrefix(k, "etag_"):
+			idx, err := strconv.Atoi(strings.TrimPrefix(k, "etag_"))
+			if err == nil {
+				sess.ETags[idx] = v
+			}
+		case strings.HasPrefix(k, "chkidx_"):
+			idx, err := strconv.Atoi(strings.TrimPrefix(k, "chkidx_"))
+			if err == nil && v != "" {
+				sess.Parts[idx] = v
+			}
+		}
+	}
+	if sess.ChunkSize <= 0 {
+		sess.ChunkSize = defaultChunkSize
+	}
+	return sess, nil
+}
+
+// partSize : 第idx个分块应有的大小, 除最后一块外都等于ChunkSize
+func (s *mpSession) partSize(idx int) int64 {
+	if idx == s.ChunkCount {
+		return s.FileSize - int64(s.ChunkCount-1)*s.ChunkSize
+	}
+	return s.ChunkSize
+}
+
+// uploaded : 已上传的分块序号, 升序
+func (s *mpSession) uploaded() []int {
+	idxs := []int{}
+	for idx := 1; idx <= s.ChunkCount; idx++ {
+		if _, ok := s.Parts[idx]; ok {
+			idxs = append(idxs, idx)
+		}
+	}
+	return idxs
+}
+
+// missing : 尚未上传的分块序号, 升序, 客户端据此断点续传
+func (s *mpSession) missing() []int {
+	idxs := []int{}
+	for idx := 1; idx <= s.ChunkCount; idx++ {
+		if _, ok := s.Parts[idx]; !ok {
+			idxs = append(idxs, idx)
+		}
+	}
+	return idxs
+}
+
+// direct : 分块是否直接上传到后端存储
+func (s *mpSession) direct() bool {
+	return s.BackendUploadID != ""
+}
+
+// stagingKey : 直传对象在校验通过前的暂存位置, 每个会话独立, 不会覆盖已有文件
+func stagingKey(t common.StoreType, uploadID string) string {
+	return store.Addr(t, cfg.UploadStagingDir+uploadID)
+}
+
+// isStaging : ObjectKey是否为暂存位置; 旧版本创建的会话直接写入最终位置, 清理时不能删除
+func (s *mpSession) isStaging() bool {
+	return s.ObjectKey != "" && s.ObjectKey == stagingKey(s.StoreType, s.UploadID)
+}
+
+// finalKey : 校验通过后对象的最终位置, 以filehash命名
+func (s *mpSession) finalKey() string {
+	return store.Addr(s.StoreType, s.FileHash)
+}
+
+// backend : 获取分块直传使用的后端存储
+func (s *mpSession) backend() (store.MultipartStore, error) {
+	st, err := store.Get(s.StoreType)
+	if err != nil {
+		return nil, err
+	}
+	mst, ok := st.(store.MultipartStore)
+	if !ok {
+		return nil, fmt.Errorf("store type %d does not support multipart upload", s.StoreType)
+	}
+	return mst, nil
+}
+
+// backendParts : 已上传到后端的分块, 按序号升序
+func (s *mpSession) backendParts() []store.Part {
+	parts := make([]store.Part, 0, len(s.ETags))
+	for idx, etag := range s.ETags {
+		parts = append(parts, store.Part{Number: idx, ETag: etag})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	return parts
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidUploadID(t *testing.T) {
+	id, err := newUploadID()
+	require.NoError(t, err)
+	assert.True(t, validUploadID(id))
+	// 旧版本以用户名开头的id
+	assert.True(t, validUploadID("alice17c9a0b1d2e3f4a5"))
+
+	for _, id := range []string{"", ".", "..", "../x", "a/b", `a\b`} {
+		assert.False(t, validUploadID(id), id)
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	dbcli "cloud_distributed_storage/Backend/service/dbproxy/client"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTransferListLimit : 查询转移任务时单次最多返回的记录数
+const maxTransferListLimit = 100
+
+// TransferStatusHandler : 查询当前用户对该文件发起的转移任务状态
+func TransferStatusHandler(c *gin.Context) {
+	username := c.Request.FormValue("username")
+	filehash := c.Request.FormValue("filehash")
+	if len(username) == 0 || len(filehash) == 0 {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "params invalid", "data": nil})
+		return
+	}
+
+	resp, err := dbcli.GetTransferJobsByFile(username, filehash)
+	if err != nil || resp == nil || !resp.Suc {
+		log.Println(err)
+		c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "查询失败", "data": nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "OK", "data": resp.Data})
+}
+
+// TransferListHandler : 查询用户最近的转移任务
+func TransferListHandler(c *gin.Context) {
+	username := c.Request.FormValue("username")
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if len(username) == 0 || err != nil || limit <= 0 {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "params invalid", "data": nil})
+		return
+	}
+	if limit > maxTransferListLimit {
+		limit = maxTransferListLimit
+	}
+
+	resp, err := dbcli.GetTransferJobsByUser(username, limit)
+	if err != nil || resp == nil || !resp.Suc {
+		log.Println(err)
+		c.JSON(http.StatusOK, gin.H{"code": -2, "msg": "查询失败", "data": nil})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "OK", "data": resp.Data})
+}
@@ -1,34 +1,41 @@
 package api
 
 import (
-	"bytes"
 	"cloud_distributed_storage/Backend/common"
 	cfg "cloud_distributed_storage/Backend/config"
-	"cloud_distributed_storage/Backend/mq"
 	dbcli "cloud_distributed_storage/Backend/service/dbproxy/client"
-	"cloud_distributed_storage/Backend/service/dbproxy/orm"
-	"cloud_distributed_storage/Backend/store/minio"
-	"cloud_distributed_storage/Backend/store/s3"
+	"cloud_distributed_storage/Backend/store/dedup"
+	"cloud_distributed_storage/Backend/store/policy"
 	"cloud_distributed_storage/Backend/util"
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
-	"regexp"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// errFileTooLarge : 上传的文件超出大小限制
+var errFileTooLarge = errors.New("file exceeds upload size limit")
+
 // UploadHandler: handle file upload
 func UploadHandler(c *gin.Context) {
 	errCode := 0
 	defer func() {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-		if errCode < 0 {
+		if errCode == -7 {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"code": errCode,
+				"msg":  fmt.Sprintf("文件超出大小限制(%d字节)", cfg.UploadMaxSize),
+			})
+		} else if errCode < 0 {
 			c.JSON(http.StatusOK, gin.H{
 				"code": errCode,
 				"msg":  "上传失败",
@@ -40,122 +47,43 @@ func UploadHandler(c *gin.Context) {
 			})
 		}
 	}()
-	// parse request
-	file, head, err := c.Request.FormFile("file")
-	if err != nil {
-		log.Printf("Failed to get form data, err:%s\n", err.Error())
-		errCode = -1
-		return
-	}
 	username, exists := c.Get("username")
 	if !exists {
-		log.Printf("Failed to get file data, err:%s\n", err.Error())
-		errCode = -2
-		return
-	}
-	defer file.Close()
-
-	// 2. 把文件内容转为[]byte
-	buf := bytes.NewBuffer(nil)
-	if _, err := io.Copy(buf, file); err != nil {
-		log.Printf("Failed to get file data, err:%s\n", err.Error())
+		log.Println("Failed to get username from context")
 		errCode = -2
 		return
 	}
 
-	// 3. 构建文件元信息
-	fileMeta := dbcli.FileMeta{
-		FileName: head.Filename,
-		FileSha1: util.Sha1(buf.Bytes()), //　计算文件sha1
-		FileSize: int64(len(buf.Bytes())),
-		UploadAt: time.Now().Format("2006-01-02 15:04:05"),
-	}
-
-	// 判断存储策略
-	var storageType string
-	if isImportantFile(fileMeta) {
-		storageType = "ceph"
-	} else {
-		storageType = "s3"
-	}
-
-	// 4. 将文件写入临时存储位置
-	fileMeta.Location = cfg.TempLocalRootDir + fileMeta.FileSha1 // 临时存储地址
-	newFile, err := os.Create(fileMeta.Location)
+	// 1. 流式读取文件内容写入临时存储位置, 同时计算sha1
+	fileMeta, form, err := receiveFile(c)
 	if err != nil {
-		log.Printf("Failed to create file, err:%s\n", err.Error())
-		errCode = -3
-		return
-	}
-	defer newFile.Close()
-
-	nByte, err := newFile.Write(buf.Bytes())
-	if int64(nByte) != fileMeta.FileSize || err != nil {
-		log.Printf("Failed to save data into file, writtenSize:%d, err:%s\n", nByte, err.Error())
-		errCode = -4
-		return
-	}
-	// 5. 同步或异步将文件转移到Ceph/S3
-	newFile.Seek(0, 0) // 游标重新回到文件头部
-
-	switch storageType {
-	case "ceph":
-		// save file into ceph
-
-		data, _ := ioutil.ReadAll(newFile)
-		cephPath := cfg.MinioRootDir + fileMeta.FileSha1
-		_ = minio.PutObject("filestore", cephPath, data, "application/octet-stream")
-		fileMeta.Location = cephPath
-		if err != nil {
-			c.JSON(http.StatusOK, util.NewRespMsg(-1, "Failed to save data into Ceph", nil))
-			return
-		}
-		fileMeta.Location = cephPath
-	case "s3":
-		// 文件写入S3存储
-		s3Path := cfg.S3RootDir + fileMeta.FileSha1
-		// 判断写入S3为同步还是异步
-		if !cfg.AsyncTransferEnable {
-			// TODO: 设置s3中的文件名，方便指定文件名下载
-			s3Client := s3.GetS3Client()
-			bucketBasics := s3.BucketBasics{S3Client: s3Client}
-			err = bucketBasics.UploadFile(cfg.S3_BUCKET_NAME, s3Path, newFile)
-			if err != nil {
-				log.Println(err.Error())
-				errCode = -5
-				return
-			}
-			fileMeta.Location = s3Path
+		log.Printf("Failed to receive file data, err:%s\n", err.Error())
+		if errors.Is(err, errFileTooLarge) {
+			errCode = -7
 		} else {
-			data := mq.TransferData{
-				FileHash:      fileMeta.FileSha1,
-				CurLocation:   fileMeta.Location,
-				DestLocation:  s3Path,
-				DestStoreType: common.StoreS3,
-			}
-			pubData, _ := json.Marshal(data)
-			log.Printf("start to publish message to transcode: %s\n", pubData)
-			pubSuc := mq.Publish(cfg.TransExchangeName, cfg.TransS3RoutingKey, pubData)
-			if !pubSuc {
-				log.Println("文件转移消息发送失败，稍后重试")
-			}
+			errCode = -1
 		}
+		return
 	}
 
-	//6.  更新文件表记录
-	_, err = dbcli.OnFileUploadFinished(fileMeta)
+	// 2. 按放置策略选择存储
+	storeType := placementOf(form, username.(string), fileMeta.FileName, fileMeta.FileSize)
+
+	// 3. 同步或异步将文件转移到目标存储
+	fileMeta.Location, err = placeFile(c.Request.Context(), storeType, username.(string), fileMeta.FileSha1, fileMeta.Location)
 	if err != nil {
-		errCode = -6
+		log.Println(err.Error())
+		errCode = -5
 		return
 	}
 
-	// 更新用户文件表记录
-	upRes, err := dbcli.OnUserFileUploadFinished(username.(string), fileMeta)
-	if err == nil && upRes.Suc {
-		errCode = 0
-	} else {
+	// 4. 在同一事务中更新文件表及用户文件表记录
+	if err = dbcli.OnUploadFinished(username.(string), fileMeta); err != nil {
+		log.Println(err.Error())
 		errCode = -6
+		return
 	}
+	errCode = 0
 }
 
 // TryFastUploadHandler : 尝试秒传接口
@@ -186,7 +114,7 @@ func TryFastUploadHandler(c *gin.Context) {
 	}
 
 	// 4. 上传过则将文件信息写入用户文件表， 返回成功
-	fmeta := dbcli.TableFileToFileMeta(fileMetaResp.Data.(orm.TableFile))
+	fmeta := dbcli.TableFileToFileMeta(fileMetaResp.Data)
 	fmeta.FileName = filename
 	upRes, err := dbcli.OnUserFileUploadFinished(username, fmeta)
 	if err == nil && upRes.Suc {
@@ -205,12 +133,143 @@ func TryFastUploadHandler(c *gin.Context) {
 	return
 }
 
-// 判断文件是否为重要文件
-func isImportantFile(fileMeta dbcli.FileMeta) bool {
-	// 可以根据文件名、大小、类型等条件判断
-	matched, _ := regexp.MatchString("VI$", fileMeta.FileName)
-	if matched {
-		return true
+// receiveFile : 从multipart请求中流式读取file字段写入本地临时存储, 避免将整个文件缓存在内存中
+// 其余表单字段一并收集返回, 请求体被流式读取后无法再通过FormValue获取
+func receiveFile(c *gin.Context) (dbcli.FileMeta, url.Values, error) {
+	fileMeta := dbcli.FileMeta{}
+	fields := url.Values{}
+	// 预留1MB给其他表单字段及multipart边界
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.UploadMaxSize+1<<20)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return fileMeta, fields, err
+	}
+
+	received := false
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			removeReceived(received, fileMeta)
+			return fileMeta, fields, uploadErr(err)
+		}
+		switch {
+		case part.FormName() != "file":
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize))
+			if err != nil {
+				part.Close()
+				removeReceived(received, fileMeta)
+				return fileMeta, fields, uploadErr(err)
+			}
+			fields.Add(part.FormName(), string(value))
+		case !received:
+			if fileMeta, err = saveFilePart(part); err != nil {
+				part.Close()
+				return fileMeta, fields, err
+			}
+			received = true
+		}
+		// 重复的file字段直接丢弃
+		part.Close()
+	}
+	if !received {
+		return fileMeta, fields, http.ErrMissingFile
+	}
+	return fileMeta, fields, nil
+}
+
+// maxFormFieldSize : 单个非文件表单字段的最大长度
+const maxFormFieldSize = 64 << 10
+
+// saveFilePart : 将file字段写入本地临时存储, 同时计算sha1
+func saveFilePart(part *multipart.Part) (dbcli.FileMeta, error) {
+	fileMeta := dbcli.FileMeta{}
+	tmpFile, err := os.CreateTemp(cfg.TempLocalRootDir, "upload-*")
+	if err != nil {
+		return fileMeta, err
+	}
+	sha1Stream := &util.Sha1Stream{}
+	// 多读1个字节用于判断是否超出大小限制
+	n, err := io.Copy(io.MultiWriter(tmpFile, sha1Stream), io.LimitReader(part, cfg.UploadMaxSize+1))
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > cfg.UploadMaxSize {
+		err = errFileTooLarge
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return fileMeta, uploadErr(err)
+	}
+
+	fileMeta = dbcli.FileMeta{
+		FileName: part.FileName(),
+		FileSha1: sha1Stream.Sum(),
+		FileSize: n,
+		UploadAt: time.Now().Format("2006-01-02 15:04:05"),
+	}
+	fileMeta.Location = cfg.TempLocalRootDir + fileMeta.FileSha1 // 临时存储地址
+	if err = os.Rename(tmpFile.Name(), fileMeta.Location); err != nil {
+		os.Remove(tmpFile.Name())
+		return fileMeta, err
+	}
+	return fileMeta, nil
+}
+
+// removeReceived : 读取后续表单字段失败时清理已写入的临时文件
+func removeReceived(received bool, fileMeta dbcli.FileMeta) {
+	if received {
+		os.Remove(fileMeta.Location)
+	}
+}
+
+// uploadErr : 将请求体超出MaxBytesReader限制的错误统一转换为errFileTooLarge
+func uploadErr(err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return errFileTooLarge
+	}
+	return err
+}
+
+// placeFile : 将本地临时文件写入目标存储, 返回文件最终的存储地址
+// 目标为S3且开启异步转移时只投递转移任务, 文件暂时留在本地, 由transfer服务完成转移;
+// StoreMix/StoreAll先写入主存储, 再由placeExtras保存其余副本
+func placeFile(ctx context.Context, storeType common.StoreType, username, filehash, localPath string) (string, error) {
+	if cfg.ChunkDedupEnable {
+		// 分块去重模式下文件按内容切分后统一写入分块存储
+		f, err := os.Open(localPath)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		return dedup.Put(ctx, filehash, f)
+	}
+
+	primary, _ := policy.Targets(storeType)
+	destPath := localPath
+	switch {
+	case primary == common.StoreLocal:
+	case primary == common.StoreS3 && cfg.AsyncTransferEnable:
+		publishTransfer(username, filehash, localPath, primary, false)
+	default:
+		var err error
+		if destPath, err = copyTo(ctx, primary, filehash, localPath); err != nil {
+			return "", err
+		}
+	}
+	placeExtras(ctx, storeType, username, filehash, destPath)
+	return destPath, nil
+}
+
+// createTransferJob : 记录转移任务, 失败时返回0, 不影响文件转移本身
+func createTransferJob(username, filehash, srcAddr, destAddr string, storeType common.StoreType) int64 {
+	resp, err := dbcli.CreateTransferJob(filehash, username, srcAddr, destAddr, storeType)
+	if err != nil || resp == nil || !resp.Suc {
+		log.Printf("failed to create transfer job for %s: %v\n", filehash, err)
+		return 0
 	}
-	return false
+	return resp.Data
 }
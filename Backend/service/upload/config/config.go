@@ -5,3 +5,6 @@ var UploadEntry = "localhost:28080"
 
 // UploadServiceHost : 上传服务监听的地址
 var UploadServiceHost = "0.0.0.0:28080"
+
+// UploadMetricsHost : 运行指标(/debug/vars)监听的地址, 仅供内部访问
+var UploadMetricsHost = "127.0.0.1:28081"
@@ -5,6 +5,7 @@ import (
 	"cloud_distributed_storage/Backend/config"
 	"cloud_distributed_storage/Backend/mq"
 	dbproxy "cloud_distributed_storage/Backend/service/dbproxy/client"
+	"cloud_distributed_storage/Backend/service/upload/api"
 	cfg "cloud_distributed_storage/Backend/service/upload/config"
 	upProto "cloud_distributed_storage/Backend/service/upload/proto"
 	"cloud_distributed_storage/Backend/service/upload/route"
@@ -56,6 +57,12 @@ func startRPCService() {
 	}
 }
 
+func startMetricsService() {
+	if err := route.MetricsRouter().Run(cfg.UploadMetricsHost); err != nil {
+		log.Println(err)
+	}
+}
+
 func startAPIService() {
 	router := route.Router()
 	err := router.Run(cfg.UploadServiceHost)
@@ -90,6 +97,12 @@ func main() {
 		return
 	}
 
+	// 清理过期的分块上传会话
+	api.StartSessionReaper(config.UploadSessionReapInterval)
+
+	// 内部指标服务
+	go startMetricsService()
+
 	// api 服务
 	go startAPIService()
 
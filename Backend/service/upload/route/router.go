@@ -2,6 +2,8 @@ package route
 
 import (
 	"cloud_distributed_storage/Backend/service/upload/api"
+	"expvar"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -29,7 +31,22 @@ func Router() *gin.Engine {
 	r.POST("/file/mpupload/complete", api.CompleteUploadHandler)
 	r.POST("file/mpupload/cancel", api.CancelUploadHandler)
 	r.POST("file/mpupload/status", api.MultipartUploadStatusHandler)
-	r.POST("file/mpupload/multi", api.MultiDownloadHandler)
 
+	// 预签名直传接口
+	r.POST("/file/presign/init", api.PresignInitHandler)
+	r.POST("/file/presign/part", api.PresignPartHandler)
+	r.POST("/file/presign/confirm", api.PresignConfirmHandler)
+
+	// 文件转移任务查询接口
+	r.GET("/file/transfer/status", api.TransferStatusHandler)
+	r.GET("/file/transfer/list", api.TransferListHandler)
+
+	return r
+}
+
+// MetricsRouter : 运行指标(含过期上传会话清理统计), 只在内部地址监听, 不对外暴露
+func MetricsRouter() *gin.Engine {
+	r := gin.New()
+	r.GET("/debug/vars", gin.WrapH(expvar.Handler()))
 	return r
 }
@@ -0,0 +1,129 @@
+package chunker
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// Options : 分块大小参数(字节)
+type Options struct {
+	MinSize int
+	AvgSize int
+	MaxSize int
+}
+
+// DefaultOptions : 默认分块参数, 平均1MB
+var DefaultOptions = Options{
+	MinSize: 256 * 1024,
+	AvgSize: 1024 * 1024,
+	MaxSize: 4 * 1024 * 1024,
+}
+
+// gear : FastCDC使用的随机表, 由固定种子生成, 保证不同节点/版本的切分结果一致
+var gear [256]uint64
+
+func init() {
+	// splitmix64
+	seed := uint64(0x2545f4914f6cdd1d)
+	for i := range gear {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// Chunker : 基于FastCDC的内容定义分块器
+// 相同内容总会被切分出相同的块, 文件中间插入或删除数据只会影响附近的少数块
+type Chunker struct {
+	rd    io.Reader
+	opts  Options
+	maskS uint64
+	maskL uint64
+	buf   []byte
+	start int
+	end   int
+	eof   bool
+}
+
+// New : 创建分块器
+func New(rd io.Reader, opts Options) (*Chunker, error) {
+	if opts.MinSize <= 0 || opts.MinSize > opts.AvgSize || opts.AvgSize > opts.MaxSize {
+		return nil, errors.New("chunker: invalid chunk size options")
+	}
+	avgBits := bits.Len(uint(opts.AvgSize)) - 1
+	return &Chunker{
+		rd:   rd,
+		opts: opts,
+		// 归一化分块: 未达到平均大小前使用更严格的掩码, 之后使用更宽松的掩码
+		maskS: ^uint64(0) << (64 - (avgBits + 2)),
+		maskL: ^uint64(0) << (64 - (avgBits - 2)),
+		buf:   make([]byte, opts.MaxSize),
+	}, nil
+}
+
+// Next : 返回下一个分块, 数据读完后返回io.EOF
+// 返回的切片在下一次调用Next之前有效
+func (c *Chunker) Next() ([]byte, error) {
+	if c.end-c.start < c.opts.MaxSize && !c.eof {
+		if err := c.fill(); err != nil {
+			return nil, err
+		}
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	n := c.cut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+func (c *Chunker) fill() error {
+	copy(c.buf, c.buf[c.start:c.end])
+	c.end -= c.start
+	c.start = 0
+	for c.end < len(c.buf) && !c.eof {
+		n, err := c.rd.Read(c.buf[c.end:])
+		c.end += n
+		if err == io.EOF {
+			c.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cut : 计算data中第一个分块的长度
+func (c *Chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.opts.MinSize {
+		return n
+	}
+	if n > c.opts.MaxSize {
+		n = c.opts.MaxSize
+	}
+	normal := c.opts.AvgSize
+	if n < normal {
+		normal = n
+	}
+
+	var h uint64
+	i := c.opts.MinSize
+	for ; i < normal; i++ {
+		h = (h << 1) + gear[data[i]]
+		if h&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = (h << 1) + gear[data[i]]
+		if h&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
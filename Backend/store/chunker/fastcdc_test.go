@@ -0,0 +1,68 @@
+package chunker
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testOptions = Options{MinSize: 512, AvgSize: 2048, MaxSize: 8192}
+
+func split(t *testing.T, data []byte) [][]byte {
+	c, err := New(bytes.NewReader(data), testOptions)
+	assert.NoError(t, err)
+
+	var chunks [][]byte
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		chunks = append(chunks, append([]byte(nil), chunk...))
+	}
+	return chunks
+}
+
+func TestChunkerReassemble(t *testing.T) {
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	chunks := split(t, data)
+	assert.Equal(t, data, bytes.Join(chunks, nil))
+	for i, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), testOptions.MaxSize)
+		if i < len(chunks)-1 {
+			assert.GreaterOrEqual(t, len(chunk), testOptions.MinSize)
+		}
+	}
+}
+
+func TestChunkerShiftResistant(t *testing.T) {
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(2)).Read(data)
+	modified := append([]byte("inserted at the head of the file"), data...)
+
+	seen := map[[sha1.Size]byte]bool{}
+	for _, chunk := range split(t, data) {
+		seen[sha1.Sum(chunk)] = true
+	}
+	chunks := split(t, modified)
+	shared := 0
+	for _, chunk := range chunks {
+		if seen[sha1.Sum(chunk)] {
+			shared++
+		}
+	}
+	// 只有开头附近的块会受到影响
+	assert.GreaterOrEqual(t, shared, len(chunks)-2)
+}
+
+func TestInvalidOptions(t *testing.T) {
+	_, err := New(bytes.NewReader(nil), Options{MinSize: 10, AvgSize: 5, MaxSize: 20})
+	assert.Error(t, err)
+}
@@ -0,0 +1,285 @@
+package dedup
+
+import (
+	"bytes"
+	cfg "cloud_distributed_storage/Backend/config"
+	dbcli "cloud_distributed_storage/Backend/service/dbproxy/client"
+	"cloud_distributed_storage/Backend/service/dbproxy/orm"
+	"cloud_distributed_storage/Backend/store"
+	"cloud_distributed_storage/Backend/store/chunker"
+	"cloud_distributed_storage/Backend/util"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// IsManifest : 判断file_addr是否指向分块去重存储的文件
+func IsManifest(addr string) bool {
+	return strings.HasPrefix(addr, cfg.ChunkManifestRootDir)
+}
+
+// ManifestAddr : 分块去重文件的file_addr
+func ManifestAddr(filehash string) string {
+	return cfg.ChunkManifestRootDir + filehash
+}
+
+// emptyHash : 空文件的sha1, 空文件的分块清单中没有分块
+var emptyHash = util.Sha1(nil)
+
+// newChunkAddr : 新上传分块在对象存储中的地址
+// 同一分块被释放后可能重新上传, 每次上传使用不同地址, 避免释放时的延迟删除误删新上传的对象
+func newChunkAddr(chunkHash string) (string, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return store.Addr(cfg.ChunkStoreType, "chunk_"+chunkHash+"_"+hex.EncodeToString(nonce)), nil
+}
+
+// Put : 将文件按内容切分后写入分块存储, 已存在的分块不再重复上传, 返回文件的file_addr
+func Put(ctx context.Context, filehash string, r io.Reader) (addr string, err error) {
+	if chunks, err := manifest(filehash); err == nil && len(chunks) > 0 {
+		return ManifestAddr(filehash), nil
+	}
+
+	st, err := store.Get(cfg.ChunkStoreType)
+	if err != nil {
+		return "", err
+	}
+	ck, err := chunker.New(r, chunker.DefaultOptions)
+	if err != nil {
+		return "", err
+	}
+
+	// 已增加引用计数的分块, 失败时归还
+	var acquired []string
+	defer func() {
+		if err != nil && len(acquired) > 0 {
+			unref(ctx, acquired)
+		}
+	}()
+
+	var chunks []orm.TableFileChunk
+	var reused int
+	for idx := 0; ; idx++ {
+		data, err := ck.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		chunkHash := util.Sha1(data)
+		chunkAddr, ok, err := acquire(ctx, st, chunkHash, data)
+		if err != nil {
+			return "", err
+		}
+		acquired = append(acquired, chunkHash)
+		if ok {
+			reused++
+		}
+		chunks = append(chunks, orm.TableFileChunk{
+			FileHash:   filehash,
+			ChunkIndex: idx,
+			ChunkHash:  chunkHash,
+			ChunkSize:  int64(len(data)),
+			ChunkAddr:  chunkAddr,
+		})
+	}
+
+	resp, err := dbcli.AddFileChunks(filehash, chunks)
+	if err != nil {
+		return "", err
+	}
+	if resp == nil || !resp.Suc {
+		return "", fmt.Errorf("dedup: failed to save chunk manifest of %s", filehash)
+	}
+	// 其他请求已先保存了该文件的清单, 本次的引用已归还
+	deleteChunks(ctx, resp.Data)
+	log.Printf("file %s stored as %d chunks, %d reused\n", filehash, len(chunks), reused)
+	return ManifestAddr(filehash), nil
+}
+
+// acquire : 增加分块的引用计数并返回分块地址, reused表示复用了已存在的分块
+// 引用计数与Release在数据库同一行上互斥, 分块已被释放时重新上传
+func acquire(ctx context.Context, st store.Store, chunkHash string, data []byte) (addr string, reused bool, err error) {
+	resp, err := dbcli.AcquireChunk(chunkHash)
+	if err != nil {
+		return "", false, err
+	}
+	if resp == nil || !resp.Suc {
+		return "", false, fmt.Errorf("dedup: failed to acquire chunk %s", chunkHash)
+	}
+	if resp.Data != "" {
+		return resp.Data, true, nil
+	}
+
+	if addr, err = newChunkAddr(chunkHash); err != nil {
+		return "", false, err
+	}
+	if err = st.Put(ctx, addr, bytes.NewReader(data), int64(len(data))); err != nil {
+		return "", false, err
+	}
+	added, err := dbcli.AddChunk(chunkHash, int64(len(data)), addr)
+	if err != nil {
+		// 无法确认是否已登记, 保留已上传的对象
+		return "", false, err
+	}
+	if added == nil || !added.Suc {
+		deleteChunks(ctx, []string{addr})
+		return "", false, fmt.Errorf("dedup: failed to add chunk %s", chunkHash)
+	}
+	if added.Data != addr {
+		// 其他请求同时上传了该分块并先完成登记, 复用其分块
+		deleteChunks(ctx, []string{addr})
+		return added.Data, true, nil
+	}
+	return addr, false, nil
+}
+
+// unref : 归还分块的引用并删除不再被引用的分块
+func unref(ctx context.Context, chunkHashes []string) {
+	resp, err := dbcli.UnrefChunks(chunkHashes)
+	if err == nil && (resp == nil || !resp.Suc) {
+		err = errors.New("dedup: failed to unref chunks")
+	}
+	if err != nil {
+		log.Printf("failed to unref %d chunks: %v\n", len(chunkHashes), err)
+		return
+	}
+	deleteChunks(ctx, resp.Data)
+}
+
+// deleteChunks : 从存储中删除分块, 返回删除成功的数量
+func deleteChunks(ctx context.Context, addrs []string) int {
+	deleted := 0
+	for _, addr := range addrs {
+		st, err := store.ByLocation(addr)
+		if err == nil {
+			err = st.Delete(ctx, addr)
+		}
+		if err != nil {
+			log.Printf("failed to delete chunk %s: %v\n", addr, err)
+			continue
+		}
+		deleted++
+	}
+	return deleted
+}
+
+// Open : 按file_addr读取文件内容, 兼容普通对象与分块清单
+// 从offset开始读取length字节, length<0表示读到结尾
+func Open(ctx context.Context, addr string, offset, length int64) (io.ReadCloser, error) {
+	if !IsManifest(addr) {
+		st, err := store.ByLocation(addr)
+		if err != nil {
+			return nil, err
+		}
+		return st.RangeGet(ctx, addr, offset, length)
+	}
+
+	filehash := strings.TrimPrefix(addr, cfg.ChunkManifestRootDir)
+	chunks, err := manifest(filehash)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		if filehash == emptyHash {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		return nil, store.ErrNotFound
+	}
+	return &chunkReader{ctx: ctx, chunks: chunks, skip: offset, remain: length}, nil
+}
+
+// Release : 删除文件的分块清单, 并清理不再被任何文件引用的分块
+func Release(ctx context.Context, filehash string) error {
+	resp, err := dbcli.ReleaseFileChunks(filehash)
+	if err != nil {
+		return err
+	}
+	if resp == nil || !resp.Suc {
+		return fmt.Errorf("dedup: failed to release chunks of %s", filehash)
+	}
+
+	deleted := deleteChunks(ctx, resp.Data)
+	log.Printf("file %s released, %d chunks deleted\n", filehash, deleted)
+	return nil
+}
+
+func manifest(filehash string) ([]orm.TableFileChunk, error) {
+	resp, err := dbcli.GetFileChunks(filehash)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || !resp.Suc {
+		return nil, fmt.Errorf("dedup: failed to load chunk manifest of %s", filehash)
+	}
+	return resp.Data, nil
+}
+
+// chunkReader : 按清单顺序依次读取各分块
+type chunkReader struct {
+	ctx    context.Context
+	chunks []orm.TableFileChunk
+	skip   int64
+	remain int64
+	cur    io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.remain == 0 {
+			return 0, io.EOF
+		}
+		if r.cur == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			chunk := r.chunks[0]
+			r.chunks = r.chunks[1:]
+			if r.skip >= chunk.ChunkSize {
+				r.skip -= chunk.ChunkSize
+				continue
+			}
+			st, err := store.ByLocation(chunk.ChunkAddr)
+			if err != nil {
+				return 0, err
+			}
+			if r.cur, err = st.RangeGet(r.ctx, chunk.ChunkAddr, r.skip, -1); err != nil {
+				return 0, err
+			}
+			r.skip = 0
+		}
+
+		if r.remain > 0 && int64(len(p)) > r.remain {
+			p = p[:r.remain]
+		}
+		n, err := r.cur.Read(p)
+		if r.remain > 0 {
+			r.remain -= int64(n)
+		}
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"cloud_distributed_storage/Backend/common"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	Register(common.StoreLocal, func() (Store, error) {
+		return localStore{}, nil
+	})
+}
+
+// localStore : 节点本地磁盘, key即文件的绝对路径
+type localStore struct{}
+
+func (localStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := os.MkdirAll(filepath.Dir(key), 0744); err != nil {
+		return err
+	}
+	// 先写临时文件再重命名, 避免读到写了一半的文件; 同一key可能被并发写入, 每次写入使用独立的临时文件
+	f, err := os.CreateTemp(filepath.Dir(key), filepath.Base(key)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	// CreateTemp创建的文件权限为0600, 与os.Create保持一致以便其他服务读取
+	err = f.Chmod(0644)
+	if err == nil {
+		_, err = io.Copy(f, r)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, key)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func (s localStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.RangeGet(ctx, key, 0, -1)
+}
+
+func (localStore) RangeGet(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if offset > 0 {
+		if _, err = f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+func (localStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	fi, err := os.Stat(key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ObjectInfo{}, ErrNotFound
+		}
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{Key: key, Size: fi.Size(), LastModified: fi.ModTime()}, nil
+}
+
+func (localStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(key)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (localStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objs []ObjectInfo
+	err := filepath.Walk(filepath.Dir(prefix), func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() || !strings.HasPrefix(path, prefix) {
+			return nil
+		}
+		objs = append(objs, ObjectInfo{Key: path, Size: fi.Size(), LastModified: fi.ModTime()})
+		return nil
+	})
+	return objs, err
+}
+
+func (s localStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	src, err := s.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return s.Put(ctx, dstKey, src, -1)
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"cloud_distributed_storage/Backend/common"
+	cfg "cloud_distributed_storage/Backend/config"
+	mstore "cloud_distributed_storage/Backend/store/minio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func init() {
+	Register(common.StoreMinio, func() (Store, error) {
+		return &minioStore{client: mstore.GetMinioClient(), bucket: cfg.MinioBucket}, nil
+	})
+}
+
+// minioStore : MinIO驱动
+type minioStore struct {
+	client *minio.Client
+	bucket string
+}
+
+func minioErr(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *minioStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size,
+		minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	return err
+}
+
+func (s *minioStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.RangeGet(ctx, key, 0, -1)
+}
+
+func (s *minioStore) RangeGet(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if length > 0 {
+		if err := opts.SetRange(offset, offset+length-1); err != nil {
+			return nil, err
+		}
+	} else if offset > 0 {
+		if err := opts.SetRange(offset, 0); err != nil {
+			return nil, err
+		}
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, key, opts)
+	if err != nil {
+		return nil, minioErr(err)
+	}
+	// GetObject是惰性的, 先Stat一次以便尽早发现对象不存在
+	if _, err = obj.Stat(); err != nil {
+		obj.Close()
+		return nil, minioErr(err)
+	}
+	return obj, nil
+}
+
+func (s *minioStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, minioErr(err)
+	}
+	return ObjectInfo{Key: key, Size: info.Size, LastModified: info.LastModified, ETag: info.ETag}, nil
+}
+
+func (s *minioStore) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *minioStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objs []ObjectInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return objs, obj.Err
+		}
+		objs = append(objs, ObjectInfo{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified, ETag: obj.ETag})
+	}
+	return objs, nil
+}
+
+// Copy : ComposeObject在对象超过单次复制上限(5GB)时自动按分块复制
+func (s *minioStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	_, err := s.client.ComposeObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: dstKey},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: srcKey})
+	return minioErr(err)
+}
+
+func (s *minioStore) InitMultipart(ctx context.Context, key string) (string, error) {
+	core := minio.Core{Client: s.client}
+	return core.NewMultipartUpload(ctx, s.bucket, key,
+		minio.PutObjectOptions{ContentType: "application/octet-stream"})
+}
+
+func (s *minioStore) UploadPart(ctx context.Context, key, uploadID string, number int, r io.Reader, size int64) (string, error) {
+	core := minio.Core{Client: s.client}
+	part, err := core.PutObjectPart(ctx, s.bucket, key, uploadID, number, r, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return "", err
+	}
+	return part.ETag, nil
+}
+
+func (s *minioStore) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error {
+	core := minio.Core{Client: s.client}
+	completed := make([]minio.CompletePart, 0, len(parts))
+	for _, p := range parts {
+		completed = append(completed, minio.CompletePart{PartNumber: p.Number, ETag: p.ETag})
+	}
+	_, err := core.CompleteMultipartUpload(ctx, s.bucket, key, uploadID, completed, minio.PutObjectOptions{})
+	return err
+}
+
+func (s *minioStore) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	core := minio.Core{Client: s.client}
+	return core.AbortMultipartUpload(ctx, s.bucket, key, uploadID)
+}
+
+func (s *minioStore) PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedPutObject(ctx, s.bucket, key, expiry)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s *minioStore) PresignPart(ctx context.Context, key, uploadID string, number int, expiry time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("partNumber", strconv.Itoa(number))
+	params.Set("uploadId", uploadID)
+	u, err := s.client.Presign(ctx, http.MethodPut, s.bucket, key, expiry, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (s *minioStore) PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,26 @@
+package store
+
+import (
+	"context"
+	"io"
+)
+
+// Part : 已上传到后端的分块
+type Part struct {
+	Number int
+	ETag   string
+}
+
+// MultipartStore : 支持原生分块上传的存储(S3/MinIO)
+// 分块直接写入后端, 由后端完成合并, 不再需要本地合并
+type MultipartStore interface {
+	Store
+	// InitMultipart : 创建分块上传, 返回后端的uploadID
+	InitMultipart(ctx context.Context, key string) (string, error)
+	// UploadPart : 上传一个分块(number从1开始), 返回分块的ETag
+	UploadPart(ctx context.Context, key, uploadID string, number int, r io.Reader, size int64) (string, error)
+	// CompleteMultipart : 按分块序号合并为完整对象
+	CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error
+	// AbortMultipart : 取消分块上传并清理已上传的分块
+	AbortMultipart(ctx context.Context, key, uploadID string) error
+}
@@ -0,0 +1,244 @@
+package policy
+
+import (
+	"cloud_distributed_storage/Backend/common"
+	cfg "cloud_distributed_storage/Backend/config"
+	"cloud_distributed_storage/Backend/store"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// storeNames : 配置文件中使用的存储类型名称
+var storeNames = map[string]common.StoreType{
+	"local": common.StoreLocal,
+	"ceph":  common.StoreCeph,
+	"s3":    common.StoreS3,
+	"mix":   common.StoreMix,
+	"all":   common.StoreAll,
+	"minio": common.StoreMinio,
+}
+
+// FileInfo : 参与放置决策的文件属性
+type FileInfo struct {
+	Name  string
+	Size  int64
+	MIME  string
+	Owner string
+	Roles []string
+	Tags  []string
+}
+
+// Rule : 一条放置规则, 所有已设置的条件同时满足时命中
+type Rule struct {
+	Name string `json:"name"`
+	// MinSize/MaxSize : 文件大小范围(字节), MaxSize为0表示不限
+	MinSize int64 `json:"min_size"`
+	MaxSize int64 `json:"max_size"`
+	// Exts : 扩展名(含"."), 不区分大小写
+	Exts []string `json:"exts"`
+	// MIMEs : MIME类型前缀, 如"video/"
+	MIMEs []string `json:"mimes"`
+	// NamePattern : 文件名正则
+	NamePattern string   `json:"name_pattern"`
+	Owners      []string `json:"owners"`
+	Roles       []string `json:"roles"`
+	Tags        []string `json:"tags"`
+	// Store : 命中后使用的存储类型名称, 见storeNames
+	Store string `json:"store"`
+
+	nameRe    *regexp.Regexp
+	storeType common.StoreType
+}
+
+// Policy : 按顺序匹配的放置规则, 都不命中时使用Default
+type Policy struct {
+	Rules   []Rule `json:"rules"`
+	Default string `json:"default"`
+
+	defaultType common.StoreType
+}
+
+// builtin : 未配置策略文件时的默认策略, 与原先isImportantFile的行为一致
+var builtin = Policy{
+	Rules: []Rule{
+		{Name: "important", NamePattern: "VI$", Store: "minio"},
+	},
+	Default: "s3",
+}
+
+// Parse : 解析并校验json格式的策略
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Load : 从文件加载策略
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func (p *Policy) compile() error {
+	t, err := storeOf(p.Default)
+	if err != nil {
+		return fmt.Errorf("policy: default store: %v", err)
+	}
+	p.defaultType = t
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.storeType, err = storeOf(r.Store); err != nil {
+			return fmt.Errorf("policy: rule %q: %v", r.Name, err)
+		}
+		if r.NamePattern != "" {
+			re, err := regexp.Compile(r.NamePattern)
+			if err != nil {
+				return fmt.Errorf("policy: rule %q: %v", r.Name, err)
+			}
+			r.nameRe = re
+		}
+	}
+	return nil
+}
+
+// storeOf : 解析存储类型名称, 其主存储及副本存储都须已注册驱动, 避免上传时才失败
+func storeOf(name string) (common.StoreType, error) {
+	t, ok := storeNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown store %q", name)
+	}
+	primary, extras := Targets(t)
+	for _, s := range append([]common.StoreType{primary}, extras...) {
+		if !store.Registered(s) {
+			return 0, fmt.Errorf("store %q has no registered driver", name)
+		}
+	}
+	return t, nil
+}
+
+// Place : 按规则顺序选择文件的存储类型
+func (p *Policy) Place(f FileInfo) common.StoreType {
+	if f.MIME == "" {
+		f.MIME = mime.TypeByExtension(filepath.Ext(f.Name))
+	}
+	for i := range p.Rules {
+		if p.Rules[i].match(f) {
+			return p.Rules[i].storeType
+		}
+	}
+	return p.defaultType
+}
+
+// UsesRoles : 是否有按角色匹配的规则, 没有时调用方无需查询用户角色
+func (p *Policy) UsesRoles() bool {
+	for _, r := range p.Rules {
+		if len(r.Roles) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) match(f FileInfo) bool {
+	if f.Size < r.MinSize || (r.MaxSize > 0 && f.Size > r.MaxSize) {
+		return false
+	}
+	if len(r.Exts) > 0 && !containsFold(r.Exts, filepath.Ext(f.Name)) {
+		return false
+	}
+	if len(r.MIMEs) > 0 && !hasPrefixAny(f.MIME, r.MIMEs) {
+		return false
+	}
+	if r.nameRe != nil && !r.nameRe.MatchString(f.Name) {
+		return false
+	}
+	if len(r.Owners) > 0 && !containsFold(r.Owners, f.Owner) {
+		return false
+	}
+	if len(r.Roles) > 0 && !intersects(r.Roles, f.Roles) {
+		return false
+	}
+	if len(r.Tags) > 0 && !intersects(r.Tags, f.Tags) {
+		return false
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefixAny(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func intersects(a, b []string) bool {
+	for _, s := range b {
+		if containsFold(a, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Targets : 存储类型对应的主存储, 以及需要额外保存一份数据的存储
+// StoreMix先写入MinIO再异步转移到S3; StoreAll同时写入MinIO及S3
+func Targets(t common.StoreType) (primary common.StoreType, extra []common.StoreType) {
+	switch t {
+	case common.StoreMix, common.StoreAll:
+		return common.StoreMinio, []common.StoreType{common.StoreS3}
+	}
+	return t, nil
+}
+
+var (
+	mu      sync.Mutex
+	current *Policy
+)
+
+// Default : 当前生效的策略, 首次调用时从cfg.StoragePolicyFile加载, 未配置或加载失败时使用内置策略
+func Default() *Policy {
+	mu.Lock()
+	defer mu.Unlock()
+	if current != nil {
+		return current
+	}
+	current = &builtin
+	if err := current.compile(); err != nil {
+		panic(err)
+	}
+	if cfg.StoragePolicyFile != "" {
+		p, err := Load(cfg.StoragePolicyFile)
+		if err != nil {
+			log.Printf("failed to load storage policy %s, using builtin policy: %v\n", cfg.StoragePolicyFile, err)
+		} else {
+			current = p
+		}
+	}
+	return current
+}
@@ -0,0 +1,59 @@
+package policy
+
+import (
+	"cloud_distributed_storage/Backend/common"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExamplePolicy(t *testing.T) {
+	p, err := Load("../../config/storage_policy.example.json")
+	assert.NoError(t, err)
+
+	cases := []struct {
+		file FileInfo
+		want common.StoreType
+	}{
+		{FileInfo{Name: "reportVI", Size: 10}, common.StoreMinio},
+		{FileInfo{Name: "a.bin", Owner: "bob", Roles: []string{"Admin"}}, common.StoreAll},
+		{FileInfo{Name: "a.bin", Tags: []string{"archive"}}, common.StoreS3},
+		{FileInfo{Name: "notes.MD", Size: 1024}, common.StoreMinio},
+		{FileInfo{Name: "notes.md", Size: 2 << 20}, common.StoreS3},
+		{FileInfo{Name: "movie.mp4", Size: 200 << 20}, common.StoreMix},
+		{FileInfo{Name: "movie.mp4", Size: 10 << 20}, common.StoreS3},
+		{FileInfo{Name: "raw", Size: 200 << 20, MIME: "audio/wav"}, common.StoreMix},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, p.Place(c.file), c.file.Name)
+	}
+	assert.True(t, p.UsesRoles())
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse([]byte(`{"rules":[{"store":"tape"}],"default":"s3"}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`{"rules":[{"name_pattern":"(","store":"s3"}],"default":"s3"}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`{"default":"nowhere"}`))
+	assert.Error(t, err)
+	// ceph未注册驱动
+	_, err = Parse([]byte(`{"default":"ceph"}`))
+	assert.Error(t, err)
+}
+
+func TestBuiltinPolicy(t *testing.T) {
+	p := Default()
+	assert.Equal(t, common.StoreMinio, p.Place(FileInfo{Name: "fileVI"}))
+	assert.Equal(t, common.StoreS3, p.Place(FileInfo{Name: "file.txt"}))
+	assert.False(t, p.UsesRoles())
+}
+
+func TestTargets(t *testing.T) {
+	primary, extra := Targets(common.StoreMix)
+	assert.Equal(t, common.StoreMinio, primary)
+	assert.Equal(t, []common.StoreType{common.StoreS3}, extra)
+	primary, extra = Targets(common.StoreS3)
+	assert.Equal(t, common.StoreS3, primary)
+	assert.Empty(t, extra)
+}
@@ -0,0 +1,16 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Presigner : 支持预签名URL的存储(S3/MinIO), 客户端可直接与存储桶交互而不经过服务端
+type Presigner interface {
+	// PresignPut : 生成上传整个对象的PUT地址
+	PresignPut(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// PresignPart : 生成上传分块的PUT地址, uploadID来自MultipartStore.InitMultipart
+	PresignPart(ctx context.Context, key, uploadID string, number int, expiry time.Duration) (string, error)
+	// PresignGet : 生成下载对象的GET地址
+	PresignGet(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
@@ -0,0 +1,115 @@
+package replica
+
+import (
+	"cloud_distributed_storage/Backend/common"
+	dbcli "cloud_distributed_storage/Backend/service/dbproxy/client"
+	"cloud_distributed_storage/Backend/store"
+	"cloud_distributed_storage/Backend/store/dedup"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// Add : 记录文件在其他存储中的副本
+func Add(filehash, addr string) error {
+	storeType, ok := store.Locate(addr)
+	if !ok {
+		return fmt.Errorf("replica: unknown location %s", addr)
+	}
+	resp, err := dbcli.AddFileReplica(filehash, addr, storeType)
+	if err != nil {
+		return err
+	}
+	if resp == nil || !resp.Suc {
+		return fmt.Errorf("replica: failed to record %s of %s", addr, filehash)
+	}
+	return nil
+}
+
+// Locations : 文件的所有存储位置, 主位置file_addr在前, 其余副本按写入顺序排列
+func Locations(filehash, primary string) []string {
+	addrs := []string{primary}
+	resp, err := dbcli.GetFileReplicas(filehash)
+	if err != nil || resp == nil || !resp.Suc {
+		log.Printf("failed to get replicas of %s: %v\n", filehash, err)
+		return addrs
+	}
+	for _, r := range resp.Data {
+		if r.FileAddr != primary {
+			addrs = append(addrs, r.FileAddr)
+		}
+	}
+	return addrs
+}
+
+// Pick : 返回第一个可访问的存储位置, 主位置所在存储不可用时切换到副本
+func Pick(ctx context.Context, filehash, primary string) (string, common.StoreType, error) {
+	var storeType common.StoreType
+	addr, err := failover(filehash, primary, func(addr string) error {
+		if dedup.IsManifest(addr) {
+			storeType = 0
+			return nil
+		}
+		st, err := store.ByLocation(addr)
+		if err == nil {
+			_, err = st.Stat(ctx, addr)
+		}
+		storeType, _ = store.Locate(addr)
+		return err
+	})
+	return addr, storeType, err
+}
+
+// Open : 读取文件内容, 依次尝试主位置及各副本, 参数含义同dedup.Open
+func Open(ctx context.Context, filehash, primary string, offset, length int64) (io.ReadCloser, error) {
+	var rd io.ReadCloser
+	_, err := failover(filehash, primary, func(addr string) (err error) {
+		rd, err = dedup.Open(ctx, addr, offset, length)
+		return err
+	})
+	return rd, err
+}
+
+// failover : 先尝试主位置, 失败后才查询副本逐个尝试, 返回成功的位置
+func failover(filehash, primary string, try func(addr string) error) (string, error) {
+	err := try(primary)
+	if err == nil {
+		return primary, nil
+	}
+	log.Printf("primary location %s of %s unavailable: %v\n", primary, filehash, err)
+	for _, addr := range Locations(filehash, primary)[1:] {
+		if err = try(addr); err == nil {
+			log.Printf("failover %s to replica %s\n", filehash, addr)
+			return addr, nil
+		}
+		log.Printf("replica %s of %s unavailable: %v\n", addr, filehash, err)
+	}
+	return "", err
+}
+
+// Purge : 删除文件在主位置及所有副本中的对象, 并清除副本记录
+func Purge(ctx context.Context, filehash, primary string) error {
+	var firstErr error
+	for _, addr := range Locations(filehash, primary) {
+		var err error
+		if dedup.IsManifest(addr) {
+			err = dedup.Release(ctx, filehash)
+		} else if st, e := store.ByLocation(addr); e != nil {
+			err = e
+		} else if err = st.Delete(ctx, addr); errors.Is(err, store.ErrNotFound) {
+			err = nil
+		}
+		if err == nil && addr != primary {
+			_, err = dbcli.RemoveFileReplica(filehash, addr)
+		}
+		if err != nil {
+			log.Printf("failed to delete %s of %s: %v\n", addr, filehash, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
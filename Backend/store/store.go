@@ -0,0 +1,119 @@
+package store
+
+import (
+	"cloud_distributed_storage/Backend/common"
+	cfg "cloud_distributed_storage/Backend/config"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound : 对象不存在
+var ErrNotFound = errors.New("store: object not found")
+
+// ObjectInfo : 对象元信息
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ETag         string
+}
+
+// Store : 统一的对象存储接口, key即tbl_file中的file_addr
+type Store interface {
+	// Put : 以流的方式写入对象, size未知时传-1
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get : 读取整个对象
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// RangeGet : 从offset开始读取length字节, length<0表示读到结尾
+	RangeGet(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Stat : 查询对象元信息
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete : 删除对象
+	Delete(ctx context.Context, key string) error
+	// List : 列出指定前缀下的对象
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Copy : 在同一存储内复制对象
+	Copy(ctx context.Context, srcKey, dstKey string) error
+}
+
+// Factory : 创建存储驱动
+type Factory func() (Store, error)
+
+var (
+	mu        sync.Mutex
+	factories = map[common.StoreType]Factory{}
+	instances = map[common.StoreType]Store{}
+)
+
+// Register : 注册存储驱动
+func Register(t common.StoreType, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[t] = f
+}
+
+// Registered : 指定类型是否已注册存储驱动
+func Registered(t common.StoreType) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	_, ok := factories[t]
+	return ok
+}
+
+// Get : 获取指定类型的存储驱动
+func Get(t common.StoreType) (Store, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if s, ok := instances[t]; ok {
+		return s, nil
+	}
+	f, ok := factories[t]
+	if !ok {
+		return nil, fmt.Errorf("store: no driver registered for store type %d", t)
+	}
+	s, err := f()
+	if err != nil {
+		return nil, err
+	}
+	instances[t] = s
+	return s, nil
+}
+
+// Locate : 根据file_addr判断文件所在的存储类型
+func Locate(addr string) (common.StoreType, bool) {
+	switch {
+	case strings.HasPrefix(addr, cfg.TempLocalRootDir):
+		return common.StoreLocal, true
+	case strings.HasPrefix(addr, cfg.MinioRootDir):
+		return common.StoreMinio, true
+	case strings.HasPrefix(addr, cfg.S3RootDir):
+		return common.StoreS3, true
+	}
+	return 0, false
+}
+
+// Addr : 生成文件在指定存储中的file_addr
+func Addr(t common.StoreType, filehash string) string {
+	switch t {
+	case common.StoreMinio:
+		return cfg.MinioRootDir + filehash
+	case common.StoreS3:
+		return cfg.S3RootDir + filehash
+	default:
+		return cfg.TempLocalRootDir + filehash
+	}
+}
+
+// ByLocation : 根据file_addr获取对应的存储驱动
+func ByLocation(addr string) (Store, error) {
+	t, ok := Locate(addr)
+	if !ok {
+		return nil, fmt.Errorf("store: unknown location %q", addr)
+	}
+	return Get(t)
+}
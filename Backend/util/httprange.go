@@ -0,0 +1,140 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidRange : Range请求头格式错误
+	ErrInvalidRange = errors.New("invalid range")
+	// ErrRangeNotSatisfiable : Range请求头中没有任何区间落在文件范围内
+	ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// HTTPRange : Range请求头中的一个字节区间
+type HTTPRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange : 该区间对应的Content-Range响应头
+func (r HTTPRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange : 按RFC 7233解析Range请求头, size为文件大小
+// 支持"a-b"、"a-"(到结尾)、"-n"(最后n字节)及逗号分隔的多个区间, 超出文件结尾的部分被截断;
+// 请求头为空时返回nil, 所有区间都不在文件范围内时返回ErrRangeNotSatisfiable
+func ParseRange(s string, size int64) ([]HTTPRange, error) {
+	if s == "" {
+		return nil, nil
+	}
+	const unit = "bytes="
+	if !strings.HasPrefix(s, unit) {
+		return nil, ErrInvalidRange
+	}
+
+	var ranges []HTTPRange
+	noOverlap := false
+	for _, ra := range strings.Split(s[len(unit):], ",") {
+		ra = strings.TrimSpace(ra)
+		if ra == "" {
+			continue
+		}
+		start, end, ok := strings.Cut(ra, "-")
+		if !ok {
+			return nil, ErrInvalidRange
+		}
+		start, end = strings.TrimSpace(start), strings.TrimSpace(end)
+
+		var r HTTPRange
+		if start == "" {
+			// 后缀区间: 最后n个字节
+			n, err := strconv.ParseInt(end, 10, 64)
+			if end == "" || err != nil || n < 0 {
+				return nil, ErrInvalidRange
+			}
+			if n == 0 || size == 0 {
+				noOverlap = true
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r.Start, r.Length = size-n, n
+		} else {
+			i, err := strconv.ParseInt(start, 10, 64)
+			if err != nil || i < 0 {
+				return nil, ErrInvalidRange
+			}
+			if i >= size {
+				noOverlap = true
+				continue
+			}
+			r.Start, r.Length = i, size-i
+			if end != "" {
+				j, err := strconv.ParseInt(end, 10, 64)
+				if err != nil || i > j {
+					return nil, ErrInvalidRange
+				}
+				if j < size-1 {
+					r.Length = j - i + 1
+				}
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		if noOverlap {
+			return nil, ErrRangeNotSatisfiable
+		}
+		return nil, ErrInvalidRange
+	}
+	return ranges, nil
+}
+
+// ETagMatch : 判断If-None-Match/If-Match形式的请求头是否包含etag, 弱比较
+func ETagMatch(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// RangeApplies : 按If-Range判断Range请求是否仍然有效
+// If-Range为强ETag时需与etag一致, 为日期时需与最后修改时间一致, 否则应返回完整内容
+func RangeApplies(ifRange, etag string, modTime time.Time) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		return ifRange == etag
+	}
+	if strings.HasPrefix(ifRange, "W/") {
+		return false
+	}
+	t, err := http.ParseTime(ifRange)
+	return err == nil && !modTime.IsZero() && modTime.Truncate(time.Second).Equal(t)
+}
+
+// NotModified : 按If-None-Match及If-Modified-Since判断是否可返回304
+// 同时携带两者时以If-None-Match为准
+func NotModified(ifNoneMatch, ifModifiedSince, etag string, modTime time.Time) bool {
+	if ifNoneMatch != "" {
+		return ETagMatch(ifNoneMatch, etag)
+	}
+	if ifModifiedSince == "" || modTime.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ifModifiedSince)
+	return err == nil && !modTime.Truncate(time.Second).After(t)
+}
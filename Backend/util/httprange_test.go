@@ -0,0 +1,60 @@
+package util
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header string
+		want   []HTTPRange
+		err    error
+	}{
+		{"", nil, nil},
+		{"bytes=0-99", []HTTPRange{{0, 100}}, nil},
+		{"bytes=100-", []HTTPRange{{100, 900}}, nil},
+		{"bytes=-100", []HTTPRange{{900, 100}}, nil},
+		{"bytes=-5000", []HTTPRange{{0, 1000}}, nil},
+		{"bytes=900-5000", []HTTPRange{{900, 100}}, nil},
+		{"bytes=0-0, -1", []HTTPRange{{0, 1}, {999, 1}}, nil},
+		{"bytes=0-9,2000-3000,20-29", []HTTPRange{{0, 10}, {20, 10}}, nil},
+		{"bytes=1000-", nil, ErrRangeNotSatisfiable},
+		{"bytes=-0", nil, ErrRangeNotSatisfiable},
+		{"bytes=5-1", nil, ErrInvalidRange},
+		{"bytes=a-b", nil, ErrInvalidRange},
+		{"bytes=-", nil, ErrInvalidRange},
+		{"items=0-1", nil, ErrInvalidRange},
+	}
+	for _, c := range cases {
+		got, err := ParseRange(c.header, 1000)
+		assert.Equal(t, c.err, err, c.header)
+		assert.Equal(t, c.want, got, c.header)
+	}
+
+	_, err := ParseRange("bytes=-10", 0)
+	assert.Equal(t, ErrRangeNotSatisfiable, err)
+	assert.Equal(t, "bytes 900-999/1000", HTTPRange{900, 100}.ContentRange(1000))
+}
+
+func TestConditional(t *testing.T) {
+	etag := `"abc"`
+	mod := time.Date(2024, 5, 1, 8, 0, 0, 500, time.UTC)
+	date := mod.Format(http.TimeFormat)
+
+	assert.True(t, NotModified(`"x", W/"abc"`, "", etag, mod))
+	assert.True(t, NotModified("*", "", etag, mod))
+	assert.False(t, NotModified(`"x"`, date, etag, mod))
+	assert.True(t, NotModified("", date, etag, mod))
+	assert.False(t, NotModified("", mod.Add(-time.Hour).Format(http.TimeFormat), etag, mod))
+
+	assert.True(t, RangeApplies("", etag, mod))
+	assert.True(t, RangeApplies(etag, etag, mod))
+	assert.False(t, RangeApplies(`"old"`, etag, mod))
+	assert.False(t, RangeApplies(`W/"abc"`, etag, mod))
+	assert.True(t, RangeApplies(date, etag, mod))
+	assert.False(t, RangeApplies(date, etag, mod.Add(time.Hour)))
+}
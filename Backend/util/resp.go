@@ -37,9 +37,9 @@ func (resp *RespMsg) JSONString() string {
 }
 
 func GenSimpleRespStream(code int, msg string) []byte {
-	return []byte(fmt.Sprintf(`{"code":&d, "msg":"%s"}`, code, msg))
+	return []byte(fmt.Sprintf(`{"code":%d, "msg":"%s"}`, code, msg))
 }
 
 func GenSimpleRespString(code int, msg string) string {
-	return fmt.Sprintf(`{"code":&d, "msg":"%s"}`, code, msg)
+	return fmt.Sprintf(`{"code":%d, "msg":"%s"}`, code, msg)
 }
@@ -21,7 +21,16 @@ func (obj *Sha1Stream) Update(data []byte) {
 	obj._sha1.Write(data)
 }
 
+// Write : 实现io.Writer, 便于配合io.Copy/io.MultiWriter边读边计算sha1
+func (obj *Sha1Stream) Write(data []byte) (int, error) {
+	obj.Update(data)
+	return len(data), nil
+}
+
 func (obj *Sha1Stream) Sum() string {
+	if obj._sha1 == nil {
+		obj._sha1 = sha1.New()
+	}
 	return hex.EncodeToString(obj._sha1.Sum([]byte("")))
 }
 